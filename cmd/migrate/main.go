@@ -0,0 +1,141 @@
+// migrate 执行数据库迁移.
+//
+// 数据库配置通过 config.Load 按环境加载, 读取 databases 配置项(db.MultiRWOptions).
+// 迁移目录相对于 env.WorkDir().
+//
+// 用法:
+//	migrate [-dir migrations] [-db name] [-dry-run] up [version]
+//	migrate [-dir migrations] [-db name] [-dry-run] down [steps]
+//	migrate [-dir migrations] [-db name] status
+//	migrate [-dir migrations] [-db name] verify
+//
+// 配置示例(conf/config.dev.yml):
+//	databases:
+//	  default:
+//	    write:
+//	      host: 127.0.0.1
+//	      port: 3306
+//	      db_name: app
+//	      username: root
+//	      password: xxx
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/agztizoo/glue/config"
+	"github.com/agztizoo/glue/db"
+	"github.com/agztizoo/glue/db/migrate"
+	"github.com/agztizoo/glue/db/mysql"
+)
+
+type Config struct {
+	Databases db.MultiRWOptions `yaml:"databases"`
+}
+
+func main() {
+	dir := flag.String("dir", "migrations", "migration directory, relative to work dir")
+	name := flag.String("db", "", "database name in config, empty for all databases")
+	dryRun := flag.Bool("dry-run", false, "print pending migrations without executing")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: migrate [flags] up [version] | down [steps] | status | verify")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*dir, *name, *dryRun, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, name string, dryRun bool, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		return fmt.Errorf("command required")
+	}
+	cmd, n, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+
+	conf := &Config{}
+	if err := config.Load(conf); err != nil {
+		return err
+	}
+	dbs := conf.Databases
+	if name != "" {
+		opt, ok := dbs[name]
+		if !ok {
+			return fmt.Errorf("database not configured: %s", name)
+		}
+		dbs = db.MultiRWOptions{name: opt}
+	}
+	migrations, err := migrate.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	opts := []migrate.Option{migrate.WithOutput(os.Stdout)}
+	if dryRun {
+		opts = append(opts, migrate.WithDryRun())
+	}
+	ctx := context.Background()
+	return migrate.RunAll(dbs, mysql.Dialector, nil, func(name string, p *db.TransProvider) error {
+		fmt.Printf("== %s\n", name)
+		m := migrate.New(p, migrations, opts...)
+		switch cmd {
+		case "up":
+			_, err := m.Up(ctx, n)
+			return err
+		case "down":
+			_, err := m.Down(ctx, int(n))
+			return err
+		case "verify":
+			return m.Verify(ctx)
+		default:
+			return printStatus(ctx, m)
+		}
+	})
+}
+
+func parseArgs(args []string) (string, int64, error) {
+	cmd := args[0]
+	var n int64
+	switch cmd {
+	case "up":
+	case "down":
+		n = 1
+	case "status", "verify":
+		return cmd, 0, nil
+	default:
+		return "", 0, fmt.Errorf("unknown command: %s", cmd)
+	}
+	if len(args) > 1 {
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || v < 0 {
+			return "", 0, fmt.Errorf("invalid %s argument: %s", cmd, args[1])
+		}
+		n = v
+	}
+	return cmd, n, nil
+}
+
+func printStatus(ctx context.Context, m *migrate.Migrator) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		applied := "pending"
+		if s.Record != nil {
+			applied = s.Record.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-40s %s\n", s.Migration, applied)
+	}
+	return nil
+}
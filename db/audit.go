@@ -0,0 +1,304 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/agztizoo/glue/pubsub"
+	"github.com/agztizoo/glue/timeservice"
+)
+
+var (
+	// 审计字段列名.
+	CreatedByColumn = "created_by"
+	UpdatedByColumn = "updated_by"
+	DeletedByColumn = "deleted_by"
+	// 乐观锁版本列名.
+	VersionColumn = "version"
+
+	ErrOptimisticLock = errors.New("optimistic lock conflict")
+)
+
+const (
+	auditVersionKey     = "glue:audit_version"
+	auditVersionBumpKey = "glue:audit_version_bump"
+	auditDeletedByKey   = "glue:audit_deleted_by"
+)
+
+// WithUser 返回携带用户 ID 的 context.
+//
+// 与消息头 pubsub.MessageHeaderUserID 使用相同的 key.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, pubsub.MessageHeaderUserID, userID)
+}
+
+// UserFromContext 返回 context 中的用户 ID.
+func UserFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(pubsub.MessageHeaderUserID).(string)
+	return userID
+}
+
+// AuditHook 实现审计字段与乐观锁插件.
+//
+// 按列名约定处理模型字段:
+//   1. created_by: 创建时为空则填充 context 中的用户.
+//   2. updated_by: 创建和更新时填充 context 中的用户.
+//   3. version: 创建时为 0 则设置为 1; 更新时递增版本.
+//      更新单个结构体模型且版本不为 0 时, 添加条件 version = 当前版本,
+//      未更新任何记录时报错 ErrOptimisticLock, 并恢复模型中的版本.
+//      当前版本未知时(如: 版本为 0, 更新 map, 按条件批量更新), 使用 version = version + 1 递增, 不做版本检查.
+//   4. deleted_by: 软删除(gorm.DeletedAt)时填充 context 中的用户, Unscoped 删除不处理.
+//   5. created_at, updated_at, deleted_at: 由 gorm 处理, 时间来自 ts.
+//      ts 只作用于插件处理的创建, 更新, 删除语句, 不修改 db.Config.NowFunc.
+//
+// 版本检查只对单个结构体模型生效, 如: Save(&m), Model(&m).Updates(...).
+// 版本递增不修改模型中的版本字段.
+// UpdateColumn(s) 跳过 Hook, 不处理审计字段与版本.
+//
+// userFrom 从 context 获取用户, 为 nil 时使用 UserFromContext.
+// ts 为 nil 时使用 gorm 默认时间函数.
+//
+// 例:
+//	dial := WithInitializeHook(xxx.Dialector, AuditHook(nil, timeservice.NewTimeService()))
+func AuditHook(userFrom func(context.Context) string, ts timeservice.TimeService) func(*gorm.DB) error {
+	if userFrom == nil {
+		userFrom = UserFromContext
+	}
+	a := &audit{userFrom: userFrom, ts: ts}
+	return func(db *gorm.DB) error {
+		cb := db.Callback()
+		if err := cb.Create().Before("gorm:create").Register("glue:audit", a.create); err != nil {
+			return err
+		}
+		builder := db.ClauseBuilders["SET"]
+		db.ClauseBuilders["SET"] = func(c clause.Clause, b clause.Builder) {
+			c = bumpVersion(c, b)
+			c = setDeletedBy(c, b)
+			if builder != nil {
+				builder(c, b)
+			} else {
+				c.Build(b)
+			}
+		}
+		if err := cb.Update().Before("gorm:update").Register("glue:audit", a.beforeUpdate); err != nil {
+			return err
+		}
+		if err := cb.Update().Before("gorm:after_update").Register("glue:optimistic_lock", a.afterUpdate); err != nil {
+			return err
+		}
+		return cb.Delete().Before("gorm:delete").Register("glue:audit", a.beforeDelete)
+	}
+}
+
+type audit struct {
+	userFrom func(context.Context) string
+	ts       timeservice.TimeService
+}
+
+// useClock 当前语句使用 ts 时间.
+//
+// 与 Session(&gorm.Session{NowFunc: ...}) 相同, 复制配置后替换 NowFunc, 不影响其他语句.
+func (a *audit) useClock(db *gorm.DB) {
+	if a.ts == nil {
+		return
+	}
+	config := *db.Config
+	config.NowFunc = func() time.Time { return a.ts.Now() }
+	db.Config = &config
+}
+
+func (a *audit) create(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	a.useClock(db)
+	sch := db.Statement.Schema
+	user := a.userFrom(db.Statement.Context)
+	fills := make(map[*schema.Field]interface{})
+	if f := sch.LookUpField(CreatedByColumn); f != nil && user != "" {
+		fills[f] = user
+	}
+	if f := sch.LookUpField(UpdatedByColumn); f != nil && user != "" {
+		fills[f] = user
+	}
+	if f := sch.LookUpField(VersionColumn); f != nil {
+		fills[f] = 1
+	}
+	if len(fills) == 0 {
+		return
+	}
+	err := walkRecords(db, func(r record) error {
+		for f, value := range fills {
+			if _, isZero, _ := r.get(f); !isZero {
+				continue
+			}
+			if err := r.set(f, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.AddError(err)
+	}
+}
+
+func (a *audit) beforeUpdate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.SkipHooks {
+		return
+	}
+	a.useClock(db)
+	stmt := db.Statement
+	if f := stmt.Schema.LookUpField(UpdatedByColumn); f != nil {
+		if user := a.userFrom(stmt.Context); user != "" {
+			stmt.SetColumn(f.DBName, user, true)
+			addSelectColumn(stmt, f.DBName)
+		}
+	}
+
+	f := stmt.Schema.LookUpField(VersionColumn)
+	if f == nil || f.DBName == "" {
+		return
+	}
+	var current interface{}
+	isZero := true
+	if stmt.ReflectValue.Kind() == reflect.Struct {
+		current, isZero = f.ValueOf(stmt.Context, stmt.ReflectValue)
+	}
+	next, ok := nextVersion(current)
+	if isZero || !ok {
+		// 当前版本未知, 构建 SET 子句时递增.
+		db.InstanceSet(auditVersionBumpKey, f.DBName)
+		return
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: current},
+	}})
+	stmt.SetColumn(f.DBName, next, true)
+	addSelectColumn(stmt, f.DBName)
+	db.InstanceSet(auditVersionKey, current)
+}
+
+func (a *audit) afterUpdate(db *gorm.DB) {
+	current, ok := db.InstanceGet(auditVersionKey)
+	if !ok || db.Error != nil || db.DryRun || db.RowsAffected > 0 {
+		return
+	}
+	stmt := db.Statement
+	if f := stmt.Schema.LookUpField(VersionColumn); f != nil && stmt.ReflectValue.CanAddr() {
+		_ = f.Set(stmt.Context, stmt.ReflectValue, current)
+	}
+	db.AddError(ErrOptimisticLock)
+}
+
+func (a *audit) beforeDelete(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || stmt.Unscoped || stmt.SQL.Len() > 0 || !isSoftDelete(stmt.Schema) {
+		return
+	}
+	a.useClock(db)
+	f := stmt.Schema.LookUpField(DeletedByColumn)
+	if f == nil || f.DBName == "" {
+		return
+	}
+	user := a.userFrom(stmt.Context)
+	if user == "" {
+		return
+	}
+	// 软删除在 gorm:delete 中重建 SET 子句, 构建时添加.
+	db.InstanceSet(auditDeletedByKey, clause.Assignment{Column: clause.Column{Name: f.DBName}, Value: user})
+	if stmt.ReflectValue.CanAddr() {
+		stmt.SetColumn(f.DBName, user, true)
+	}
+}
+
+// isSoftDelete 返回模型是否使用 gorm 软删除.
+func isSoftDelete(sch *schema.Schema) bool {
+	for _, c := range sch.DeleteClauses {
+		if _, ok := c.(gorm.SoftDeleteDeleteClause); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// setDeletedBy 构建软删除 SET 子句时, 添加 deleted_by 赋值.
+func setDeletedBy(c clause.Clause, b clause.Builder) clause.Clause {
+	stmt, ok := b.(*gorm.Statement)
+	if !ok {
+		return c
+	}
+	v, ok := stmt.DB.InstanceGet(auditDeletedByKey)
+	if !ok {
+		return c
+	}
+	set, ok := c.Expression.(clause.Set)
+	if !ok {
+		return c
+	}
+	c.Expression = append(set[:len(set):len(set)], v.(clause.Assignment))
+	return c
+}
+
+// bumpVersion 构建 SET 子句时, 将版本列赋值替换为 version = version + 1.
+func bumpVersion(c clause.Clause, b clause.Builder) clause.Clause {
+	stmt, ok := b.(*gorm.Statement)
+	if !ok {
+		return c
+	}
+	v, ok := stmt.DB.InstanceGet(auditVersionBumpKey)
+	if !ok {
+		return c
+	}
+	set, ok := c.Expression.(clause.Set)
+	if !ok {
+		return c
+	}
+	column := v.(string)
+	bumped := make(clause.Set, 0, len(set)+1)
+	for _, a := range set {
+		if a.Column.Name != column {
+			bumped = append(bumped, a)
+		}
+	}
+	bumped = append(bumped, clause.Assignment{
+		Column: clause.Column{Name: column},
+		Value:  clause.Expr{SQL: "? + 1", Vars: []interface{}{clause.Column{Table: clause.CurrentTable, Name: column}}},
+	})
+	c.Expression = bumped
+	return c
+}
+
+// nextVersion 返回递增后的版本.
+func nextVersion(current interface{}) (interface{}, bool) {
+	if current == nil {
+		return nil, false
+	}
+	v := reflect.Indirect(reflect.ValueOf(current))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() + 1, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() + 1, true
+	}
+	return nil, false
+}
+
+// addSelectColumn 指定了更新字段时, 添加 column.
+func addSelectColumn(stmt *gorm.Statement, column string) {
+	if len(stmt.Selects) == 0 {
+		return
+	}
+	for _, s := range stmt.Selects {
+		if s == "*" || s == column {
+			return
+		}
+	}
+	stmt.Selects = append(stmt.Selects, column)
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type testAuditClock struct {
+	now time.Time
+}
+
+func (c *testAuditClock) Now() time.Time {
+	return c.now
+}
+
+type TestAuditModel struct {
+	ID        int64
+	Name      string
+	CreatedBy string
+	UpdatedBy string
+	DeletedBy string
+	Version   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+func TestAuditHook(t *testing.T) {
+	clock := &testAuditClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), AuditHook(nil, clock)), "audit")
+	ctx := WithUser(context.Background(), "alice")
+	if err := p.UseDB(ctx).AutoMigrate(&TestAuditModel{}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &TestAuditModel{ID: 1, Name: "name"}
+	if err := p.UseDB(ctx).Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+	if m.CreatedBy != "alice" || m.UpdatedBy != "alice" || m.Version != 1 || !m.CreatedAt.Equal(clock.now) {
+		t.Errorf("unexpected model after create: %+v", m)
+	}
+
+	t.Run("update", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Hour)
+		bctx := WithUser(context.Background(), "bob")
+		m.Name = "saved"
+		if err := p.UseDB(bctx).Save(m).Error; err != nil {
+			t.Fatal(err)
+		}
+		if m.Version != 2 || m.UpdatedBy != "bob" || m.CreatedBy != "alice" || !m.UpdatedAt.Equal(clock.now) {
+			t.Errorf("unexpected model after save: %+v", m)
+		}
+
+		if err := p.UseDB(ctx).Model(m).Updates(map[string]interface{}{"name": "map"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := p.UseDB(ctx).Model(m).Select("name").Updates(&TestAuditModel{Name: "selected"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		got := &TestAuditModel{}
+		if err := p.UseDB(ctx).First(got, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.Version != 4 || got.UpdatedBy != "alice" || got.Name != "selected" {
+			t.Errorf("unexpected stored model: %+v", got)
+		}
+	})
+
+	t.Run("optimistic lock", func(t *testing.T) {
+		stale := &TestAuditModel{}
+		if err := p.UseDB(ctx).First(stale, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		fresh := *stale
+		fresh.Name = "fresh"
+		if err := p.UseDB(ctx).Save(&fresh).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		version := stale.Version
+		stale.Name = "stale"
+		if err := p.UseDB(ctx).Save(stale).Error; !errors.Is(err, ErrOptimisticLock) {
+			t.Errorf("expect: %v, got: %v", ErrOptimisticLock, err)
+		}
+		if stale.Version != version {
+			t.Errorf("expect version restored: %d, got: %d", version, stale.Version)
+		}
+		var n int64
+		p.UseDB(ctx).Model(&TestAuditModel{}).Count(&n)
+		if n != 1 {
+			t.Errorf("expect no record created on conflict, got: %d", n)
+		}
+		err := p.UseDB(ctx).Model(stale).Updates(map[string]interface{}{"name": "stale"}).Error
+		if !errors.Is(err, ErrOptimisticLock) {
+			t.Errorf("expect: %v, got: %v", ErrOptimisticLock, err)
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		version := func() int64 {
+			got := &TestAuditModel{}
+			if err := p.UseDB(ctx).First(got, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			return got.Version
+		}
+		v := version()
+		res := p.UseDB(ctx).Model(&TestAuditModel{}).Where("id = ?", 1).Update("name", "batch")
+		if res.Error != nil || res.RowsAffected != 1 {
+			t.Fatalf("expect 1 row updated, got: %d, %v", res.RowsAffected, res.Error)
+		}
+		if got := version(); got != v+1 {
+			t.Errorf("expect version bumped on batch update: %d, got: %d", v+1, got)
+		}
+		if err := p.UseDB(ctx).Model(&TestAuditModel{ID: 1}).Updates(&TestAuditModel{Name: "zero"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got := version(); got != v+2 {
+			t.Errorf("expect version bumped on zero version model: %d, got: %d", v+2, got)
+		}
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Hour)
+		if err := p.UseDB(ctx).Delete(&TestAuditModel{}, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := p.UseDB(ctx).First(&TestAuditModel{}, 1).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expect: %v, got: %v", gorm.ErrRecordNotFound, err)
+		}
+		got := &TestAuditModel{}
+		if err := p.UseDB(ctx).Unscoped().First(got, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !got.DeletedAt.Time.Equal(clock.now) || got.DeletedBy != "alice" {
+			t.Errorf("unexpected model after soft delete: %+v", got)
+		}
+	})
+
+	t.Run("scoped clock", func(t *testing.T) {
+		now := p.UseDB(ctx).NowFunc()
+		if now.Equal(clock.now) {
+			t.Errorf("expect default NowFunc outside audit statements, got: %v", now)
+		}
+	})
+}
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrQueryBudgetExceeded = errors.New("query budget exceeded")
+)
+
+type budgetCtxKey string
+
+const (
+	queryStatsKey budgetCtxKey = "glue:query_stats"
+
+	budgetCountedKey = "glue:budget_counted"
+)
+
+// QueryBudget 定义单个请求的语句预算.
+type QueryBudget struct {
+	// 最大语句数, 小于等于 0 时不限制.
+	MaxQueries int
+	// 相同指纹语句的最大执行次数, 超过时视为 N+1 查询, 小于等于 0 时不检测.
+	MaxRepeats int
+	// 超出预算时语句返回 ErrQueryBudgetExceeded, 为 false 时仅记录警告.
+	Fail bool
+}
+
+// FingerprintCount 代表指纹的执行次数.
+type FingerprintCount struct {
+	Fingerprint string
+	Count       int
+}
+
+// QueryStats 记录单个请求执行的语句.
+type QueryStats struct {
+	budget QueryBudget
+
+	mut    sync.Mutex
+	total  int
+	counts map[string]int
+	// 指纹首次出现的顺序.
+	order []string
+	// 已警告超出 MaxQueries.
+	warned bool
+}
+
+// TrackQueries 返回记录语句的 context, 通过该 context 执行的语句计入 budget.
+//
+// 需安装 QueryBudgetHook.
+//
+// 例:
+//	ctx = db.TrackQueries(ctx, db.QueryBudget{MaxQueries: 50, MaxRepeats: 5})
+//	users, err := repo.List(ctx, req)
+func TrackQueries(ctx context.Context, budget QueryBudget) context.Context {
+	stats := &QueryStats{budget: budget, counts: make(map[string]int)}
+	return context.WithValue(ctx, queryStatsKey, stats)
+}
+
+// QueryStatsFrom 返回 context 记录的语句, 未通过 TrackQueries 记录时返回 nil.
+func QueryStatsFrom(ctx context.Context) *QueryStats {
+	stats, _ := ctx.Value(queryStatsKey).(*QueryStats)
+	return stats
+}
+
+// Count 返回已执行的语句数.
+func (s *QueryStats) Count() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.total
+}
+
+// Fingerprints 返回各指纹的执行次数, 按首次执行顺序.
+func (s *QueryStats) Fingerprints() []FingerprintCount {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	fps := make([]FingerprintCount, 0, len(s.order))
+	for _, fp := range s.order {
+		fps = append(fps, FingerprintCount{Fingerprint: fp, Count: s.counts[fp]})
+	}
+	return fps
+}
+
+// enter 记录语句开始执行, 超出 MaxQueries 时返回是否已警告与错误.
+func (s *QueryStats) enter() (warn bool, err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	max := s.budget.MaxQueries
+	if max > 0 && s.total >= max {
+		if s.budget.Fail {
+			return false, fmt.Errorf("%w: more than %d queries", ErrQueryBudgetExceeded, max)
+		}
+		warn = !s.warned
+		s.warned = true
+	}
+	s.total++
+	return warn, nil
+}
+
+// record 记录已执行语句的指纹, 返回指纹执行次数.
+func (s *QueryStats) record(fp string) int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if _, ok := s.counts[fp]; !ok {
+		s.order = append(s.order, fp)
+	}
+	s.counts[fp]++
+	return s.counts[fp]
+}
+
+// QueryBudgetHook 实现数据库初始化时, 注入语句计数与 N+1 查询检测.
+//
+// 1. 通过 TrackQueries 返回的 context 执行的语句计数, 未记录的 context 不处理.
+// 2. 语句数超过 MaxQueries 时, Fail 为 true 的语句不执行并返回 ErrQueryBudgetExceeded,
+//    否则记录一次警告.
+// 3. 相同指纹的语句执行次数超过 MaxRepeats 时视为 N+1 查询, Fail 为 true 时返回
+//    ErrQueryBudgetExceeded, 否则每个指纹记录一次警告.
+//
+// SQL 在执行时构建, N+1 检测在语句执行后进行. 创建, 更新, 删除在提交默认事务前检测,
+// 超出时默认事务回滚, 写入不生效; 在 Transaction 中时由调用方回滚.
+// ⚠️ 注意: SkipDefaultTransaction 且不在事务中的写入, 以及 Exec 原生 SQL, 返回错误时已执行.
+//
+// 例:
+//	dial := WithInitializeHook(mysql.Dialector, QueryBudgetHook)
+func QueryBudgetHook(db *gorm.DB) error {
+	cb := db.Callback()
+	// 写入在提交默认事务前检测, 超出时回滚.
+	const commit = "gorm:commit_or_rollback_transaction"
+	processors := []struct {
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{cb.Create().Before("*").Register, cb.Create().After("gorm:create").Before(commit).Register},
+		{cb.Query().Before("*").Register, cb.Query().After("*").Register},
+		{cb.Update().Before("*").Register, cb.Update().After("gorm:update").Before(commit).Register},
+		{cb.Delete().Before("*").Register, cb.Delete().After("gorm:delete").Before(commit).Register},
+		{cb.Row().Before("*").Register, cb.Row().After("*").Register},
+		{cb.Raw().Before("*").Register, cb.Raw().After("*").Register},
+	}
+	for _, p := range processors {
+		if err := p.before("glue:budget_before", budgetBefore); err != nil {
+			return err
+		}
+		if err := p.after("glue:budget_after", budgetAfter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func budgetBefore(db *gorm.DB) {
+	stats := QueryStatsFrom(db.Statement.Context)
+	if stats == nil || db.Error != nil || db.DryRun {
+		return
+	}
+	warn, err := stats.enter()
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.InstanceSet(budgetCountedKey, true)
+	if warn {
+		logrus.WithContext(db.Statement.Context).WithFields(logrus.Fields{
+			"max_queries": stats.budget.MaxQueries,
+			"caller":      sqlCaller(),
+		}).Warn("[glue][db] query budget exceeded")
+	}
+}
+
+func budgetAfter(db *gorm.DB) {
+	if _, ok := db.InstanceGet(budgetCountedKey); !ok {
+		return
+	}
+	sql := db.Statement.SQL.String()
+	if sql == "" {
+		return
+	}
+	stats := QueryStatsFrom(db.Statement.Context)
+	fp := Fingerprint(sql)
+	n := stats.record(fp)
+	max := stats.budget.MaxRepeats
+	if max <= 0 || n <= max {
+		return
+	}
+	if stats.budget.Fail {
+		_ = db.AddError(fmt.Errorf("%w: likely N+1 query, executed %d times: %s", ErrQueryBudgetExceeded, n, fp))
+		return
+	}
+	if n == max+1 {
+		logrus.WithContext(db.Statement.Context).WithFields(logrus.Fields{
+			"fingerprint": fp,
+			"max_repeats": max,
+			"caller":      sqlCaller(),
+		}).Warn("[glue][db] likely N+1 query")
+	}
+}
+
+var (
+	fingerprintList = regexp.MustCompile(`\(\?(?: ?, ?\?)*\)`)
+	fingerprintRows = regexp.MustCompile(`\(\?\+\)(?: ?, ?\(\?\+\))+`)
+)
+
+// Fingerprint 返回 SQL 语句指纹, 用于归类仅参数不同的语句.
+//
+// 字符串与数字字面量替换为 ?, 连续空白合并为一个空格,
+// IN 列表与多行 VALUES 折叠为 (?+).
+//
+// 例:
+//	SELECT * FROM users WHERE id IN (1, 2, 3) AND name = 'a'
+//	=> SELECT * FROM users WHERE id IN (?+) AND name = ?
+func Fingerprint(sql string) string {
+	var b strings.Builder
+	rs := []rune(strings.TrimSpace(sql))
+	// 前一个字符是否为标识符的一部分.
+	ident := false
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			for i+1 < len(rs) && unicode.IsSpace(rs[i+1]) {
+				i++
+			}
+			b.WriteByte(' ')
+			ident = false
+		case r == '\'':
+			i = skipQuoted(rs, i)
+			b.WriteByte('?')
+			ident = false
+		case r == '`' || r == '"':
+			// 标识符原样保留.
+			end := skipQuoted(rs, i)
+			if end >= len(rs) {
+				end = len(rs) - 1
+			}
+			b.WriteString(string(rs[i : end+1]))
+			i = end
+			ident = false
+		case r == '$' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			for i+1 < len(rs) && unicode.IsDigit(rs[i+1]) {
+				i++
+			}
+			b.WriteByte('?')
+			ident = false
+		case unicode.IsDigit(r) && !ident:
+			for i+1 < len(rs) && (unicode.IsLetter(rs[i+1]) || unicode.IsDigit(rs[i+1]) || rs[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+			ident = false
+		default:
+			b.WriteRune(r)
+			ident = r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+		}
+	}
+	fp := fingerprintList.ReplaceAllString(b.String(), "(?+)")
+	return fingerprintRows.ReplaceAllString(fp, "(?+)")
+}
+
+// skipQuoted 返回从 i 开始的引用结束位置, 支持重复引号与反斜杠转义.
+func skipQuoted(rs []rune, i int) int {
+	quote := rs[i]
+	for i++; i < len(rs); i++ {
+		switch rs[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(rs) && rs[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return i
+}
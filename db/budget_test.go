@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestFingerprint(t *testing.T) {
+	cases := []struct {
+		sql    string
+		expect string
+	}{
+		{"SELECT * FROM users WHERE id = 1", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT *  FROM\n\tusers WHERE name = 'a''b' AND t1.c2 = 3.5", "SELECT * FROM users WHERE name = ? AND t1.c2 = ?"},
+		{"SELECT * FROM `t1` WHERE `id` IN (?,?,?)", "SELECT * FROM `t1` WHERE `id` IN (?+)"},
+		{"SELECT * FROM t WHERE id IN (1, 2)", "SELECT * FROM t WHERE id IN (?+)"},
+		{"INSERT INTO t (a,b) VALUES (?,?),(?,?)", "INSERT INTO t (a,b) VALUES (?+)"},
+		{"SELECT * FROM t WHERE id = $1", "SELECT * FROM t WHERE id = ?"},
+	}
+	for _, c := range cases {
+		if fp := Fingerprint(c.sql); fp != c.expect {
+			t.Errorf("sql: %s, expect: %s, got: %s", c.sql, c.expect, fp)
+		}
+	}
+}
+
+func TestQueryBudgetHook(t *testing.T) {
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), QueryBudgetHook), "budget")
+	find := func(ctx context.Context, id int64) error {
+		return p.UseDB(ctx).Find(&TestDBModel{}, id).Error
+	}
+
+	t.Run("count", func(t *testing.T) {
+		ctx := TrackQueries(context.Background(), QueryBudget{MaxQueries: 2, MaxRepeats: 1})
+		for i := 0; i < 3; i++ {
+			if err := find(ctx, int64(i)); err != nil {
+				t.Fatalf("expect warn only, got: %v", err)
+			}
+		}
+		if err := p.UseDB(context.Background()).Find(&TestDBModel{}, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		stats := QueryStatsFrom(ctx)
+		if stats.Count() != 3 {
+			t.Errorf("expect 3 queries, got: %d", stats.Count())
+		}
+		fps := stats.Fingerprints()
+		if len(fps) != 1 || fps[0].Count != 3 {
+			t.Errorf("unexpected fingerprints: %v", fps)
+		}
+	})
+
+	t.Run("max queries", func(t *testing.T) {
+		ctx := TrackQueries(context.Background(), QueryBudget{MaxQueries: 2, Fail: true})
+		_ = find(ctx, 1)
+		if err := p.UseDB(ctx).Create(&TestDBModel{ID: 100}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := find(ctx, 100); !errors.Is(err, ErrQueryBudgetExceeded) {
+			t.Errorf("expect: %v, got: %v", ErrQueryBudgetExceeded, err)
+		}
+		if n := QueryStatsFrom(ctx).Count(); n != 2 {
+			t.Errorf("expect rejected query not counted, got: %d", n)
+		}
+	})
+
+	t.Run("repeats", func(t *testing.T) {
+		ctx := TrackQueries(context.Background(), QueryBudget{MaxRepeats: 2, Fail: true})
+		for i := 0; i < 2; i++ {
+			if err := find(ctx, int64(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := p.UseDB(ctx).Where("name = ?", "x").Find(&[]*TestDBModel{}).Error; err != nil {
+			t.Errorf("expect other fingerprint allowed, got: %v", err)
+		}
+		if err := find(ctx, 3); !errors.Is(err, ErrQueryBudgetExceeded) {
+			t.Errorf("expect N+1 detected, got: %v", err)
+		}
+	})
+
+	t.Run("repeated create", func(t *testing.T) {
+		ctx := TrackQueries(context.Background(), QueryBudget{MaxRepeats: 2, Fail: true})
+		for i := int64(200); i < 202; i++ {
+			if err := p.UseDB(ctx).Create(&TestDBModel{ID: i}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := p.UseDB(ctx).Create(&TestDBModel{ID: 202}).Error; !errors.Is(err, ErrQueryBudgetExceeded) {
+			t.Errorf("expect N+1 detected, got: %v", err)
+		}
+		// 超出预算的写入回滚.
+		if err := p.UseDB(context.Background()).First(&TestDBModel{}, 202).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expect write exceeding budget rolled back, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm/clause"
+)
+
+// DefaultBatchSize 是 BulkOptions 未指定批次大小时的默认值.
+var DefaultBatchSize = 500
+
+// ConflictStrategy 定义批量写入的冲突处理方式.
+type ConflictStrategy int
+
+const (
+	// ConflictError 冲突时报错, 即普通批量插入.
+	ConflictError ConflictStrategy = iota
+	// ConflictIgnore 冲突时忽略该行.
+	ConflictIgnore
+	// ConflictUpdate 冲突时更新指定列.
+	ConflictUpdate
+)
+
+// BulkOptions 定义批量写入配置.
+type BulkOptions struct {
+	// 每批行数, 小于 1 时为 DefaultBatchSize.
+	BatchSize int
+	// 冲突处理方式.
+	Conflict ConflictStrategy
+	// 冲突判断列(ON CONFLICT 目标), 为空时使用主键; mysql 按唯一索引判断, 忽略该配置.
+	ConflictColumns []string
+	// ConflictUpdate 时更新的列, 为空时更新除主键外的全部列.
+	UpdateColumns []string
+}
+
+// BulkUpsert 分批写入 rows, 返回每批影响行数.
+//
+// 冲突子句由 gorm 方言生成: mysql 为 ON DUPLICATE KEY UPDATE, sqlite, postgres 为 ON CONFLICT.
+// 写入经过 Create 回调, 加密等初始化插件逐行生效.
+//
+// 在事务上下文内时, 全部批次在该事务中执行; 否则每批独立执行, 出错时已写入的批次不回滚.
+// 出错时返回已完成批次的影响行数.
+//
+// ⚠️ 注意: 影响行数由驱动返回, mysql 中更新已存在的行计为 2;
+// 使用 RETURNING 的方言(sqlite, postgres)中 ConflictIgnore 忽略的行可能计入.
+//
+// 例:
+//	counts, err := db.BulkUpsert(ctx, provider, users, &db.BulkOptions{
+//		Conflict:      db.ConflictUpdate,
+//		UpdateColumns: []string{"name", "updated_at"},
+//	})
+func BulkUpsert[T any](ctx context.Context, p Provider, rows []*T, opts *BulkOptions) ([]int64, error) {
+	if opts == nil {
+		opts = &BulkOptions{}
+	}
+	size := opts.BatchSize
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+	onConflict, ok := opts.onConflict()
+	if ok && len(onConflict.Columns) == 0 {
+		stmt := p.UseWriteDB(ctx).Statement
+		if err := stmt.Parse(new(T)); err != nil {
+			return nil, err
+		}
+		for _, name := range stmt.Schema.PrimaryFieldDBNames {
+			onConflict.Columns = append(onConflict.Columns, clause.Column{Name: name})
+		}
+	}
+
+	counts := make([]int64, 0, (len(rows)+size-1)/size)
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		db := p.UseWriteDB(ctx)
+		if ok {
+			db = db.Clauses(onConflict)
+		}
+		res := db.Create(rows[start:end])
+		if res.Error != nil {
+			return counts, res.Error
+		}
+		counts = append(counts, res.RowsAffected)
+	}
+	return counts, nil
+}
+
+func (o *BulkOptions) onConflict() (clause.OnConflict, bool) {
+	var c clause.OnConflict
+	for _, name := range o.ConflictColumns {
+		c.Columns = append(c.Columns, clause.Column{Name: name})
+	}
+	switch o.Conflict {
+	case ConflictIgnore:
+		c.DoNothing = true
+	case ConflictUpdate:
+		if len(o.UpdateColumns) > 0 {
+			c.DoUpdates = clause.AssignmentColumns(o.UpdateColumns)
+		} else {
+			c.UpdateAll = true
+		}
+	default:
+		return c, false
+	}
+	return c, true
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type TestBulkModel struct {
+	ID    int64
+	Name  string
+	Phone string `encrypt:"aes"`
+}
+
+func TestBulkUpsert(t *testing.T) {
+	dial := WithInitializeHook(testdb_dial(t), CryptoHook(testCryptoMarshal, testCryptoUnmarshal))
+	p := testdb_newprovider_with_dial(t, dial, "bulk")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestBulkModel{}); err != nil {
+		t.Fatal(err)
+	}
+	rows := func(from, to int, name string) []*TestBulkModel {
+		var ms []*TestBulkModel
+		for i := from; i <= to; i++ {
+			ms = append(ms, &TestBulkModel{ID: int64(i), Name: name, Phone: fmt.Sprint("phone", i)})
+		}
+		return ms
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		counts, err := BulkUpsert(ctx, p, rows(1, 5, "a"), &BulkOptions{BatchSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(counts) != "[2 2 1]" {
+			t.Errorf("unexpected counts: %v", counts)
+		}
+		var phone string
+		p.UseDB(ctx).Raw("SELECT phone FROM test_bulk_models WHERE id = 1").Scan(&phone)
+		if phone != "phone1_encrypted" {
+			t.Errorf("expect phone encrypted, got: %s", phone)
+		}
+		if _, err := BulkUpsert(ctx, p, rows(5, 6, "a"), nil); err == nil {
+			t.Errorf("expect conflict error")
+		}
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		counts, err := BulkUpsert(ctx, p, rows(4, 7, "b"), &BulkOptions{Conflict: ConflictIgnore})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(counts) != 1 {
+			t.Errorf("unexpected counts: %v", counts)
+		}
+		var n int64
+		p.UseDB(ctx).Model(&TestBulkModel{}).Count(&n)
+		if n != 7 {
+			t.Errorf("expect 7 rows, got: %d", n)
+		}
+		m := &TestBulkModel{}
+		p.UseDB(ctx).First(m, 4)
+		if m.Name != "a" {
+			t.Errorf("expect row not updated, got: %+v", m)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		ms := rows(1, 8, "c")
+		_, err := BulkUpsert(ctx, p, ms, &BulkOptions{Conflict: ConflictUpdate, UpdateColumns: []string{"name"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []*TestBulkModel
+		p.UseDB(ctx).Order("id").Find(&got)
+		if len(got) != 8 || got[0].Name != "c" || got[0].Phone != "phone1" {
+			t.Errorf("unexpected rows: %d, %+v", len(got), got[0])
+		}
+		if ms[0].Phone != "phone1" {
+			t.Errorf("expect model decrypted after write, got: %s", ms[0].Phone)
+		}
+
+		_, err = BulkUpsert(ctx, p, rows(1, 1, "d"), &BulkOptions{Conflict: ConflictUpdate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &TestBulkModel{}
+		p.UseDB(ctx).First(m, 1)
+		if m.Name != "d" {
+			t.Errorf("expect all columns updated, got: %+v", m)
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			if _, err := BulkUpsert(ctx, p, rows(20, 25, "e"), &BulkOptions{BatchSize: 2}); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		if err == nil {
+			t.Fatal("expect rollback error")
+		}
+		var n int64
+		p.UseDB(ctx).Model(&TestBulkModel{}).Where("id >= ?", 20).Count(&n)
+		if n != 0 {
+			t.Errorf("expect all chunks rolled back, got: %d", n)
+		}
+	})
+}
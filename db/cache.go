@@ -0,0 +1,249 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/transaction"
+)
+
+// CacheKeyPrefix 查询缓存 key 前缀.
+var CacheKeyPrefix = "glue:cache:"
+
+// Cache 定义查询缓存存储.
+type Cache interface {
+	// Get 返回 key 对应的值, 不存在时 ok 为 false.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set 设置 key 对应的值, ttl 为 0 时不过期.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type cacheCtxKey string
+
+const cachedKey cacheCtxKey = "glue:cached"
+
+type cachedQuery struct {
+	key  string
+	ttl  time.Duration
+	tags []string
+}
+
+// Cached 返回标记查询缓存的 context.
+//
+// 使用该 context 的查询结果以 key 缓存 ttl, 并关联 tags; 未指定 tags 时关联查询的表名.
+// 需安装 QueryCache.Hook.
+//
+// 查询结果使用 encoding/gob 编码, 与 json tag 无关, 只缓存导出字段;
+// 字段类型自定义编码需实现 gob.GobEncoder, 结果为 map 时值中的自定义类型需 gob.Register.
+// 无法编码的结果不缓存, 缓存值无法解码时视为未命中.
+//
+// 例:
+//	var u User
+//	err := p.UseDB(db.Cached(ctx, "user:1", time.Minute)).First(&u, 1).Error
+func Cached(ctx context.Context, key string, ttl time.Duration, tags ...string) context.Context {
+	return context.WithValue(ctx, cachedKey, &cachedQuery{key: key, ttl: ttl, tags: tags})
+}
+
+// QueryCache 实现查询结果读穿缓存.
+//
+// 缓存以 tag 版本失效: 每个 tag 记录版本, 缓存 key 包含查询时 tag 的版本,
+// 失效时更新 tag 版本, 旧缓存不再命中并随 ttl 过期.
+// 查询前读取版本, 查询期间提交的写入使本次缓存不再命中.
+//
+// 创建, 更新, 删除语句在执行成功后失效表名 tag; 原生 SQL 写入需调用 Invalidate.
+// 缓存不可用时查询直接访问数据库, 失效失败时语句报错.
+// 在事务中注册的失效在事务提交后执行, 回滚时不执行.
+// 事务中的查询不读写缓存, 防止缓存未提交的数据.
+//
+// 缓存在 gorm:query 阶段, 保存的是解密等读取处理前的值; Preload 关联不缓存.
+//
+// 例:
+//	qc := db.NewQueryCache(db.NewLRUCache(10000))
+//	dial := db.WithInitializeHook(xxx.Dialector, qc.Hook)
+//	provider := db.NewProvider(source)
+//	qc.SetTransactionManager(provider)
+type QueryCache struct {
+	cache Cache
+	tm    transaction.Manager
+}
+
+// NewQueryCache 创建 QueryCache.
+func NewQueryCache(cache Cache) *QueryCache {
+	return &QueryCache{cache: cache}
+}
+
+// SetTransactionManager 设置事务管理器, 用于事务提交后执行失效.
+//
+// 未设置时立即失效.
+func (c *QueryCache) SetTransactionManager(tm transaction.Manager) {
+	c.tm = tm
+}
+
+// Hook 实现初始化插件, 安装查询缓存与写入失效回调.
+func (c *QueryCache) Hook(db *gorm.DB) error {
+	cb := db.Callback()
+	query := cb.Query().Get("gorm:query")
+	if err := cb.Query().Replace("gorm:query", c.query(query)); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register("glue:cache_invalidate", c.written); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register("glue:cache_invalidate", c.written); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:commit_or_rollback_transaction").Register("glue:cache_invalidate", c.written)
+}
+
+// Invalidate 失效 tags 关联的缓存.
+//
+// 在事务中调用时, 事务提交后失效, 返回 nil.
+// 提交后失效失败时重试一次, 仍失败只记录日志: 写入已提交, 缓存在 ttl 内可能返回旧数据.
+func (c *QueryCache) Invalidate(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if c.tm != nil && c.tm.OnCommitted(ctx, func(ctx context.Context) { c.invalidateCommitted(ctx, tags) }) {
+		return nil
+	}
+	return c.invalidate(ctx, tags)
+}
+
+func (c *QueryCache) invalidateCommitted(ctx context.Context, tags []string) {
+	err := c.invalidate(ctx, tags)
+	if err == nil {
+		return
+	}
+	if err = c.invalidate(ctx, tags); err != nil {
+		logrus.WithContext(ctx).Warnf("[glue][db] failed to invalidate query cache after commit, tags: %v, error: %v", tags, err)
+	}
+}
+
+func (c *QueryCache) invalidate(ctx context.Context, tags []string) error {
+	for _, tag := range tags {
+		if _, err := c.bumpVersion(ctx, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *QueryCache) written(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.RowsAffected == 0 || db.Statement.Table == "" {
+		return
+	}
+	if err := c.Invalidate(db.Statement.Context, db.Statement.Table); err != nil {
+		db.AddError(err)
+	}
+}
+
+func (c *QueryCache) query(next func(*gorm.DB)) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		q, ok := db.Statement.Context.Value(cachedKey).(*cachedQuery)
+		if !ok || db.Error != nil || db.DryRun {
+			next(db)
+			return
+		}
+		if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+			next(db)
+			return
+		}
+		ctx := db.Statement.Context
+		tags := q.tags
+		if len(tags) == 0 {
+			tags = []string{db.Statement.Table}
+		}
+		// 缓存不可用时直接查询.
+		key, err := c.entryKey(ctx, q.key, tags)
+		if err != nil {
+			db.Logger.Warn(ctx, "query cache unavailable: %v", err)
+			next(db)
+			return
+		}
+		value, hit, err := c.cache.Get(ctx, key)
+		if err != nil {
+			db.Logger.Warn(ctx, "query cache unavailable: %v", err)
+			next(db)
+			return
+		}
+		if hit {
+			if err := c.load(db, value); err == nil {
+				return
+			}
+			db.Logger.Warn(ctx, "query cache load %s: %v", q.key, err)
+		}
+		next(db)
+		if db.Error != nil {
+			return
+		}
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(db.Statement.Dest)
+		if err == nil {
+			err = c.cache.Set(ctx, key, buf.Bytes(), q.ttl)
+		}
+		if err != nil {
+			db.Logger.Warn(ctx, "query cache set %s: %v", q.key, err)
+		}
+	}
+}
+
+// load 从缓存填充查询结果.
+func (c *QueryCache) load(db *gorm.DB, value []byte) error {
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(db.Statement.Dest); err != nil {
+		return err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		db.RowsAffected = int64(rv.Len())
+	default:
+		db.RowsAffected = 1
+	}
+	// First, Take 等未命中记录时报错, 与查询保持一致.
+	if db.RowsAffected == 0 && db.Statement.RaiseErrorOnNotFound {
+		db.AddError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// entryKey 返回包含 tag 版本的缓存 key.
+func (c *QueryCache) entryKey(ctx context.Context, key string, tags []string) (string, error) {
+	versions := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		value, ok, err := c.cache.Get(ctx, c.versionKey(tag))
+		if err != nil {
+			return "", err
+		}
+		version := string(value)
+		// 版本不存在(或被淘汰)时生成新版本, 不复用可能过期的缓存.
+		if !ok {
+			if version, err = c.bumpVersion(ctx, tag); err != nil {
+				return "", err
+			}
+		}
+		versions = append(versions, version)
+	}
+	return CacheKeyPrefix + key + "@" + strings.Join(versions, ","), nil
+}
+
+func (c *QueryCache) bumpVersion(ctx context.Context, tag string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	version := hex.EncodeToString(b)
+	return version, c.cache.Set(ctx, c.versionKey(tag), []byte(version), 0)
+}
+
+func (c *QueryCache) versionKey(tag string) string {
+	return CacheKeyPrefix + "tag:" + tag
+}
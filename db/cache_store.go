@@ -0,0 +1,110 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// NewLRUCache 创建进程内 LRU 缓存, size 为最大条目数.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// LRUCache 实现进程内 LRU 缓存.
+type LRUCache struct {
+	mut   sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	// 用于测试插桩.
+	now func() time.Time
+}
+
+var _ Cache = new(LRUCache)
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+// Get 实现 Cache.
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := e.Value.(*lruEntry)
+	if !entry.expireAt.IsZero() && !c.timeNow().Before(entry.expireAt) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(e)
+	return entry.value, true, nil
+}
+
+// Set 实现 Cache.
+func (c *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = c.timeNow().Add(ttl)
+	}
+	if e, ok := c.items[key]; ok {
+		e.Value = &lruEntry{key: key, value: value, expireAt: expireAt}
+		c.ll.MoveToFront(e)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for c.size > 0 && c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (c *LRUCache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// NewRedisCache 创建 Redis 缓存, client 通常由 redis.New 创建.
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+// RedisCache 实现 Redis 缓存.
+type RedisCache struct {
+	client *redis.Client
+}
+
+var _ Cache = new(RedisCache)
+
+// Get 实现 Cache.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set 实现 Cache.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
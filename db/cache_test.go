@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type TestCacheModel struct {
+	ID   int64
+	Name string
+}
+
+func TestQueryCache(t *testing.T) {
+	qc := NewQueryCache(NewLRUCache(100))
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), qc.Hook), "cache")
+	qc.SetTransactionManager(p)
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestCacheModel{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UseDB(ctx).Create(&TestCacheModel{ID: 1, Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 绕过回调修改数据, 用于判断是否命中缓存.
+	rawUpdate := func(name string) {
+		if err := p.UseDB(ctx).Exec("UPDATE test_cache_models SET name = ? WHERE id = 1", name).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(ctx context.Context) string {
+		m := &TestCacheModel{}
+		if err := p.UseDB(Cached(ctx, "model:1", time.Minute)).First(m, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		return m.Name
+	}
+
+	t.Run("read through", func(t *testing.T) {
+		if name := get(ctx); name != "a" {
+			t.Fatalf("unexpected name: %s", name)
+		}
+		rawUpdate("raw")
+		if name := get(ctx); name != "a" {
+			t.Errorf("expect cached: a, got: %s", name)
+		}
+		var ms []*TestCacheModel
+		if err := p.UseDB(Cached(ctx, "models", time.Minute)).Find(&ms).Error; err != nil || len(ms) != 1 {
+			t.Errorf("unexpected models: %v, %v", ms, err)
+		}
+		if err := p.UseDB(Cached(ctx, "model:2", time.Minute)).First(&TestCacheModel{}, 2).Error; err == nil {
+			t.Errorf("expect record not found")
+		}
+		if err := qc.Invalidate(ctx, "test_cache_models"); err != nil {
+			t.Fatal(err)
+		}
+		if name := get(ctx); name != "raw" {
+			t.Errorf("expect invalidated: raw, got: %s", name)
+		}
+	})
+
+	t.Run("invalidate on write", func(t *testing.T) {
+		if err := p.UseDB(ctx).Model(&TestCacheModel{ID: 1}).Update("name", "b").Error; err != nil {
+			t.Fatal(err)
+		}
+		if name := get(ctx); name != "b" {
+			t.Errorf("expect invalidated: b, got: %s", name)
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		err := p.Transaction(ctx, func(tctx context.Context) error {
+			if err := p.UseDB(tctx).Model(&TestCacheModel{ID: 1}).Update("name", "c").Error; err != nil {
+				return err
+			}
+			// 事务中的查询不使用缓存.
+			if name := get(tctx); name != "c" {
+				t.Errorf("expect uncommitted value in transaction: c, got: %s", name)
+			}
+			return errors.New("rollback")
+		})
+		if err == nil {
+			t.Fatal("expect rollback error")
+		}
+		rawUpdate("d")
+		if name := get(ctx); name != "b" {
+			t.Errorf("expect cache kept after rollback: b, got: %s", name)
+		}
+
+		err = p.Transaction(ctx, func(tctx context.Context) error {
+			if err := p.UseDB(tctx).Model(&TestCacheModel{ID: 1}).Update("name", "e").Error; err != nil {
+				return err
+			}
+			if name := get(ctx); name != "b" {
+				t.Errorf("expect cache kept before commit: b, got: %s", name)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := get(ctx); name != "e" {
+			t.Errorf("expect invalidated after commit: e, got: %s", name)
+		}
+	})
+}
+
+type TestCacheTaggedModel struct {
+	ID      int64
+	Secret  string `json:"-"`
+	Renamed string `json:"renamed_name"`
+	Created time.Time
+}
+
+func TestQueryCache_Encoding(t *testing.T) {
+	qc := NewQueryCache(NewLRUCache(100))
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), qc.Hook), "cache_encoding")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestCacheTaggedModel{}); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &TestCacheTaggedModel{ID: 1, Secret: "secret", Renamed: "renamed", Created: created}
+	if err := p.UseDB(ctx).Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+	cctx := Cached(ctx, "tagged:1", time.Minute)
+	if err := p.UseDB(cctx).First(&TestCacheTaggedModel{}, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 绕过回调删除数据, 之后的查询只能来自缓存.
+	if err := p.UseDB(ctx).Exec("DELETE FROM test_cache_tagged_models").Error; err != nil {
+		t.Fatal(err)
+	}
+	got := &TestCacheTaggedModel{}
+	if err := p.UseDB(cctx).First(got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != "secret" || got.Renamed != "renamed" || !got.Created.Equal(created) {
+		t.Errorf("expect all fields cached, got: %+v", got)
+	}
+
+	var ms []*TestCacheTaggedModel
+	if err := p.UseDB(Cached(ctx, "tagged", time.Minute)).Find(&ms).Error; err != nil || len(ms) != 0 {
+		t.Fatalf("unexpected models: %v, %v", ms, err)
+	}
+	if err := p.UseDB(Cached(ctx, "tagged", time.Minute)).Find(&ms).Error; err != nil || len(ms) != 0 {
+		t.Errorf("expect empty result cached, got: %v, %v", ms, err)
+	}
+}
+
+type testFailingCache struct {
+	Cache
+	fail bool
+}
+
+func (c *testFailingCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c.fail && strings.Contains(key, "tag:") {
+		return errors.New("cache unavailable")
+	}
+	return c.Cache.Set(ctx, key, value, ttl)
+}
+
+func TestQueryCache_InvalidateCommittedError(t *testing.T) {
+	cache := &testFailingCache{Cache: NewLRUCache(100)}
+	qc := NewQueryCache(cache)
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), qc.Hook), "cache_invalidate_error")
+	qc.SetTransactionManager(p)
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestCacheModel{}); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := test.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+	cache.fail = true
+	if err := qc.Invalidate(ctx, "test_cache_models"); err == nil {
+		t.Error("expect invalidate error outside transaction")
+	}
+	err := p.Transaction(ctx, func(tctx context.Context) error {
+		return p.UseDB(tctx).Create(&TestCacheModel{ID: 1, Name: "a"}).Error
+	})
+	if err != nil {
+		t.Fatalf("expect committed write not failed, got: %v", err)
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.WarnLevel || !strings.Contains(entry.Message, "test_cache_models") {
+		t.Errorf("expect invalidate error logged, got: %+v", entry)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewLRUCache(2)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_ = c.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = c.Set(ctx, "b", []byte("2"), 0)
+	c.Get(ctx, "a")
+	_ = c.Set(ctx, "c", []byte("3"), 0)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Errorf("expect least recently used evicted")
+	}
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("unexpected value: %s, %v", v, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Errorf("expect expired")
+	}
+	if _, ok, _ := c.Get(ctx, "c"); !ok {
+		t.Errorf("expect no expiration")
+	}
+}
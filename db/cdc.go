@@ -0,0 +1,262 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/agztizoo/glue/idgen"
+	"github.com/agztizoo/glue/pubsub"
+)
+
+// 行变更操作类型.
+const (
+	RowCreated = "create"
+	RowUpdated = "update"
+	RowDeleted = "delete"
+)
+
+const changeCaptureKey = "glue:change_capture"
+
+// ChangeCaptured 定义需要捕获行变更的模型.
+type ChangeCaptured interface {
+	// AggregateType 返回消息头 pubsub.MessageHeaderAggregateType.
+	AggregateType() string
+}
+
+// RowChange 代表行变更, 作为消息内容发布.
+//
+// Before, After 为列名到数据库中存储值的映射, 加密字段保持加密.
+type RowChange struct {
+	// 操作类型: RowCreated, RowUpdated, RowDeleted.
+	Operation string
+	Table     string
+	// 变更前的值, 创建时为 nil.
+	Before map[string]interface{}
+	// 变更后的值, 删除时为 nil; 软删除时为删除后的值.
+	After map[string]interface{}
+}
+
+// ChangeCaptureHook 实现行变更捕获插件.
+//
+// 对实现 ChangeCaptured 的模型, 在创建, 更新, 删除后读取变更前后的行,
+// 以 pubsub.Message 发布 RowChange, 消息头包含聚合类型与聚合 ID(主键, 联合主键以逗号分隔).
+//
+// 在语句所在事务中发布, 事务提交前:
+//   1. 同步 Subscriber 在事务中处理, 出错则语句报错.
+//   2. 异步 Subscriber 在 transaction.Manager 事务提交后处理.
+// 需在 transaction.Manager 事务中执行语句, 否则异步 Subscriber 立即处理.
+//
+// 变更前后的值直接从数据库读取, 加密字段保持加密.
+// 未发生变化的行不发布.
+//
+// ⚠️ 注意: 更新和删除前按语句条件读取行, 批量更新和删除会读取全部匹配行.
+//
+// 例:
+//	pub := pubsub.NewPublisher(idg, provider, render, subs...)
+//	dial := WithInitializeHook(xxx.Dialector, ChangeCaptureHook(pub, idg))
+func ChangeCaptureHook(pub pubsub.Publisher, idg idgen.IDGenerator) func(*gorm.DB) error {
+	c := &changeCapture{pub: pub, idg: idg}
+	return func(db *gorm.DB) error {
+		cb := db.Callback()
+		if err := cb.Create().Before("gorm:commit_or_rollback_transaction").Register("glue:change_capture", c.created); err != nil {
+			return err
+		}
+		if err := cb.Update().Before("gorm:update").Register("glue:change_capture_before", c.before); err != nil {
+			return err
+		}
+		if err := cb.Update().Before("gorm:commit_or_rollback_transaction").Register("glue:change_capture", c.updated); err != nil {
+			return err
+		}
+		if err := cb.Delete().Before("gorm:delete").Register("glue:change_capture_before", c.before); err != nil {
+			return err
+		}
+		return cb.Delete().Before("gorm:commit_or_rollback_transaction").Register("glue:change_capture", c.deleted)
+	}
+}
+
+type changeCapture struct {
+	pub pubsub.Publisher
+	idg idgen.IDGenerator
+}
+
+// captured 返回模型聚合类型, 不需要捕获返回 false.
+func (c *changeCapture) captured(db *gorm.DB) (string, bool) {
+	if db.Error != nil || db.DryRun || db.Statement.Schema == nil || len(db.Statement.Schema.PrimaryFields) == 0 {
+		return "", false
+	}
+	model, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(ChangeCaptured)
+	if !ok {
+		return "", false
+	}
+	return model.AggregateType(), true
+}
+
+func (c *changeCapture) created(db *gorm.DB) {
+	aggregateType, ok := c.captured(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	sch := db.Statement.Schema
+	_, pks := schema.GetIdentityFieldValuesMap(db.Statement.Context, db.Statement.ReflectValue, sch.PrimaryFields)
+	if len(pks) == 0 {
+		return
+	}
+	after, err := c.rows(db, primaryKeyCondition(db.Statement, pks))
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	var changes []*RowChange
+	for _, row := range after {
+		changes = append(changes, &RowChange{Operation: RowCreated, Table: db.Statement.Table, After: row})
+	}
+	db.AddError(c.publish(db, aggregateType, changes))
+}
+
+// before 读取变更前的行.
+func (c *changeCapture) before(db *gorm.DB) {
+	if _, ok := c.captured(db); !ok {
+		return
+	}
+	stmt := db.Statement
+	var exprs []clause.Expression
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok {
+		exprs = append(exprs, where.Exprs...)
+	}
+	if stmt.ReflectValue.IsValid() {
+		_, pks := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+		if len(pks) > 0 {
+			exprs = append(exprs, primaryKeyCondition(stmt, pks))
+		}
+	}
+	// 无条件语句由 gorm 拒绝执行.
+	if len(exprs) == 0 && !db.AllowGlobalUpdate {
+		return
+	}
+	before, err := c.rows(db, exprs...)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(changeCaptureKey, before)
+}
+
+func (c *changeCapture) updated(db *gorm.DB) {
+	c.changed(db, RowUpdated)
+}
+
+func (c *changeCapture) deleted(db *gorm.DB) {
+	c.changed(db, RowDeleted)
+}
+
+func (c *changeCapture) changed(db *gorm.DB, operation string) {
+	aggregateType, ok := c.captured(db)
+	if !ok {
+		return
+	}
+	v, ok := db.InstanceGet(changeCaptureKey)
+	if !ok {
+		return
+	}
+	before := v.([]map[string]interface{})
+	if len(before) == 0 {
+		return
+	}
+	sch := db.Statement.Schema
+	pks := make([][]interface{}, 0, len(before))
+	for _, row := range before {
+		pk := make([]interface{}, 0, len(sch.PrimaryFieldDBNames))
+		for _, name := range sch.PrimaryFieldDBNames {
+			pk = append(pk, row[name])
+		}
+		pks = append(pks, pk)
+	}
+	after, err := c.rows(db, primaryKeyCondition(db.Statement, pks))
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[rowID(sch, row)] = row
+	}
+
+	var changes []*RowChange
+	for _, row := range before {
+		a := afterByID[rowID(sch, row)]
+		if reflect.DeepEqual(row, a) {
+			continue
+		}
+		changes = append(changes, &RowChange{Operation: operation, Table: db.Statement.Table, Before: row, After: a})
+	}
+	db.AddError(c.publish(db, aggregateType, changes))
+}
+
+// rows 在语句所在连接中读取行, 不经过 Hook 处理.
+func (c *changeCapture) rows(db *gorm.DB, exprs ...clause.Expression) ([]map[string]interface{}, error) {
+	tx := db.Session(&gorm.Session{NewDB: true}).Table(db.Statement.Table)
+	stmt := tx.Statement
+	// 条件中的 clause.PrimaryKey 依赖模型结构.
+	stmt.Schema = db.Statement.Schema
+	stmt.AddClause(clause.Select{})
+	stmt.AddClause(clause.From{})
+	stmt.AddClause(clause.Where{Exprs: exprs})
+	stmt.Build("SELECT", "FROM", "WHERE")
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	rows, err := stmt.ConnPool.QueryContext(stmt.Context, stmt.SQL.String(), stmt.Vars...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []map[string]interface{}
+	stmt.Dest = &result
+	gorm.Scan(rows, tx, 0)
+	if err := rows.Err(); err != nil {
+		tx.AddError(err)
+	}
+	return result, tx.Error
+}
+
+func (c *changeCapture) publish(db *gorm.DB, aggregateType string, changes []*RowChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	msgs := make([]interface{}, 0, len(changes))
+	for _, change := range changes {
+		id, err := c.idg.GenID()
+		if err != nil {
+			return err
+		}
+		row := change.After
+		if row == nil {
+			row = change.Before
+		}
+		msg := pubsub.NewMessage(id, change, pubsub.MessageTimeFunc())
+		msg.SetHeader(pubsub.MessageHeaderAggregateType, aggregateType)
+		msg.SetHeader(pubsub.MessageHeaderAggregateID, rowID(db.Statement.Schema, row))
+		msgs = append(msgs, msg)
+	}
+	return c.pub.Publish(db.Statement.Context, msgs...)
+}
+
+func primaryKeyCondition(stmt *gorm.Statement, pks [][]interface{}) clause.Expression {
+	column, values := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, pks)
+	return clause.IN{Column: column, Values: values}
+}
+
+// rowID 返回行主键, 联合主键以逗号分隔.
+func rowID(sch *schema.Schema, row map[string]interface{}) string {
+	ids := make([]string, 0, len(sch.PrimaryFieldDBNames))
+	for _, name := range sch.PrimaryFieldDBNames {
+		ids = append(ids, fmt.Sprint(row[name]))
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agztizoo/glue/idgen"
+	"github.com/agztizoo/glue/pubsub"
+)
+
+type TestCDCModel struct {
+	ID    int64
+	Name  string
+	Phone string `encrypt:"aes"`
+}
+
+func (*TestCDCModel) AggregateType() string {
+	return "cdc_model"
+}
+
+type testCDCSubscriber struct {
+	mut  sync.Mutex
+	msgs []*pubsub.Message
+	err  error
+}
+
+func (s *testCDCSubscriber) Name() string {
+	return "cdc"
+}
+
+func (s *testCDCSubscriber) IsSupported(msg *pubsub.Message) bool {
+	return true
+}
+
+func (s *testCDCSubscriber) OnEvent(ctx context.Context, msg *pubsub.Message) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.msgs = append(s.msgs, msg)
+	return s.err
+}
+
+func (s *testCDCSubscriber) reset() []*pubsub.Message {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	msgs := s.msgs
+	s.msgs = nil
+	return msgs
+}
+
+type testCDCSyncSubscriber struct {
+	testCDCSubscriber
+}
+
+func (s *testCDCSyncSubscriber) SynchronousSubscriber() {}
+
+func TestChangeCaptureHook(t *testing.T) {
+	var (
+		n     int64
+		idmut sync.Mutex
+	)
+	idg := idgen.New(func() (int64, error) {
+		idmut.Lock()
+		defer idmut.Unlock()
+		n++
+		return n, nil
+	}, nil)
+	syncSub := &testCDCSyncSubscriber{}
+	asyncSub := &testCDCSubscriber{}
+
+	var p *TransProvider
+	pub := pubsub.NewPublisher(idg, transactionManagerFunc(func() *TransProvider { return p }), nil, syncSub, asyncSub)
+	dial := WithInitializeHook(testdb_dial(t),
+		CryptoHook(testCryptoMarshal, testCryptoUnmarshal),
+		ChangeCaptureHook(pub, idg))
+	p = testdb_newprovider_with_dial(t, dial, "cdc")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestCDCModel{}); err != nil {
+		t.Fatal(err)
+	}
+	waitAsync := func(expect int) []*pubsub.Message {
+		for i := 0; i < 100; i++ {
+			asyncSub.mut.Lock()
+			got := len(asyncSub.msgs)
+			asyncSub.mut.Unlock()
+			if got >= expect {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return asyncSub.reset()
+	}
+
+	t.Run("create", func(t *testing.T) {
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			if err := p.UseDB(ctx).Create(&TestCDCModel{ID: 1, Name: "name", Phone: "phone"}).Error; err != nil {
+				return err
+			}
+			if msgs := asyncSub.reset(); len(msgs) != 0 {
+				t.Errorf("expect async subscriber not scheduled before commit, got: %d", len(msgs))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs := syncSub.reset()
+		if len(msgs) != 1 {
+			t.Fatalf("expect 1 message, got: %d", len(msgs))
+		}
+		msg := msgs[0]
+		if msg.GetAggregateType() != "cdc_model" || msg.GetAggregateID() != "1" {
+			t.Errorf("unexpected headers: %s, %s", msg.GetAggregateType(), msg.GetAggregateID())
+		}
+		change := msg.GetPayload().(*RowChange)
+		if change.Operation != RowCreated || change.Before != nil || change.After["phone"] != "phone_encrypted" {
+			t.Errorf("unexpected change: %+v", change)
+		}
+		if msgs := waitAsync(1); len(msgs) != 1 {
+			t.Errorf("expect async subscriber scheduled after commit, got: %d", len(msgs))
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		if err := p.UseDB(ctx).Model(&TestCDCModel{ID: 1}).Updates(map[string]interface{}{"name": "updated"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		msgs := syncSub.reset()
+		if len(msgs) != 1 {
+			t.Fatalf("expect 1 message, got: %d", len(msgs))
+		}
+		change := msgs[0].GetPayload().(*RowChange)
+		if change.Operation != RowUpdated || change.Before["name"] != "name" || change.After["name"] != "updated" || change.After["phone"] != "phone_encrypted" {
+			t.Errorf("unexpected change: %+v", change)
+		}
+
+		// 未变化的行不发布.
+		if err := p.UseDB(ctx).Model(&TestCDCModel{ID: 1}).Updates(map[string]interface{}{"name": "updated"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if msgs := syncSub.reset(); len(msgs) != 0 {
+			t.Errorf("expect no message of unchanged row, got: %d", len(msgs))
+		}
+		waitAsync(1)
+	})
+
+	t.Run("sync subscriber error", func(t *testing.T) {
+		syncSub.err = errors.New("sync error")
+		defer func() { syncSub.err = nil }()
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			return p.UseDB(ctx).Create(&TestCDCModel{ID: 2, Name: "name"}).Error
+		})
+		if err == nil || err.Error() != "sync error" {
+			t.Errorf("expect sync error, got: %v", err)
+		}
+		var n int64
+		p.UseDB(ctx).Model(&TestCDCModel{}).Where("id = ?", 2).Count(&n)
+		if n != 0 {
+			t.Errorf("expect rolled back, got: %d", n)
+		}
+		syncSub.reset()
+		if msgs := waitAsync(0); len(msgs) != 0 {
+			t.Errorf("expect async subscriber not scheduled, got: %d", len(msgs))
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := p.UseDB(ctx).Delete(&TestCDCModel{}, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		msgs := syncSub.reset()
+		if len(msgs) != 1 {
+			t.Fatalf("expect 1 message, got: %d", len(msgs))
+		}
+		change := msgs[0].GetPayload().(*RowChange)
+		if change.Operation != RowDeleted || change.After != nil || change.Before["phone"] != "phone_encrypted" {
+			t.Errorf("unexpected change: %+v", change)
+		}
+		if msgs[0].GetAggregateID() != "1" {
+			t.Errorf("unexpected aggregate id: %s", msgs[0].GetAggregateID())
+		}
+	})
+}
+
+// transactionManagerFunc 延迟获取事务管理器, 用于 Provider 创建前构造 Publisher.
+type transactionManagerFunc func() *TransProvider
+
+func (f transactionManagerFunc) Transaction(ctx context.Context, callback func(context.Context) error) error {
+	return f().Transaction(ctx, callback)
+}
+
+func (f transactionManagerFunc) EscapeTransaction(ctx context.Context, callback func(context.Context) error) error {
+	return f().EscapeTransaction(ctx, callback)
+}
+
+func (f transactionManagerFunc) OnCommitted(ctx context.Context, callback func(context.Context)) bool {
+	return f().OnCommitted(ctx, callback)
+}
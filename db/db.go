@@ -61,6 +61,10 @@ type TransProvider struct {
 	transaction.Manager
 
 	scopes []func(*gorm.DB) *gorm.DB
+	// 生命周期管理, 为 nil 时不追踪事务.
+	registry *Registry
+	// 只读模式开关.
+	readOnly readOnlyState
 }
 
 var _ transaction.Manager = new(TransProvider)
@@ -95,15 +99,33 @@ func (p *TransProvider) findTransDB(ctx context.Context) *gorm.DB {
 }
 
 // transaction 执行数据库事务.
+//
+// 只读检查和 Registry 事务追踪只对最外层事务生效, 已开启事务中的嵌套事务不受影响.
 func (p *TransProvider) transaction(ctx context.Context, db interface{}, callback func(db interface{}) error) error {
-	return db.(*gorm.DB).Transaction(func(db *gorm.DB) error {
+	if p.findTransDB(ctx) == nil {
+		if err := p.checkWritable(ctx); err != nil {
+			return err
+		}
+		if p.registry != nil {
+			done, err := p.registry.enter()
+			if err != nil {
+				return err
+			}
+			defer done()
+		}
+	}
+	tx := db.(*gorm.DB)
+	err := tx.Transaction(func(db *gorm.DB) error {
 		return callback(db)
 	})
+	// 提交错误不经过语句回调, 在此分类.
+	return translateError(tx, err)
 }
 
 func (p *TransProvider) useDB(ctx context.Context, write bool) *gorm.DB {
 	db := p.findTransDB(ctx)
-	if db == nil {
+	inTrans := db != nil
+	if !inTrans {
 		db = p.lookupDB(ctx, write)
 	}
 	if db == nil {
@@ -111,7 +133,14 @@ func (p *TransProvider) useDB(ctx context.Context, write bool) *gorm.DB {
 	}
 	sess := &gorm.Session{Context: ctx}
 	// 保护逻辑
-	return db.Session(sess).Scopes(p.scopes...)
+	tx := db.Session(sess).Scopes(p.scopes...)
+	// 只读模式下写库返回错误, 已开启的事务不受影响.
+	if write && !inTrans {
+		if err := p.checkWritable(ctx); err != nil {
+			_ = tx.AddError(err)
+		}
+	}
+	return tx
 }
 
 // UseDB 实现通过 context 选择数据库.
@@ -127,6 +156,8 @@ func (p *TransProvider) UseDB(ctx context.Context) *gorm.DB {
 
 // UseWriteDB 实现通过 context 选择写库.
 //
+// 只读模式下返回的 DB 执行语句时返回 ErrReadOnlyMode.
+//
 // 无匹配 DB 时 panic.
 func (p *TransProvider) UseWriteDB(ctx context.Context) *gorm.DB {
 	return p.useDB(ctx, true)
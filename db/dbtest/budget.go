@@ -0,0 +1,44 @@
+// Package dbtest 提供基于 db.Provider 的数据库测试工具.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/agztizoo/glue/db"
+)
+
+// TrackQueries 返回记录语句的 context, 用于 MaxQueries 断言.
+//
+// 数据库需安装 db.QueryBudgetHook.
+func TrackQueries(ctx context.Context) context.Context {
+	return db.TrackQueries(ctx, db.QueryBudget{})
+}
+
+// MaxQueries 断言 ctx 已执行的语句数不超过 max, 超过时列出各语句指纹与执行次数.
+//
+// 例:
+//	ctx := dbtest.TrackQueries(context.Background())
+//	svc.ListOrders(ctx)
+//	dbtest.MaxQueries(t, ctx, 5)
+func MaxQueries(t testing.TB, ctx context.Context, max int) {
+	t.Helper()
+	stats := db.QueryStatsFrom(ctx)
+	if stats == nil {
+		t.Fatalf("queries not tracked, use dbtest.TrackQueries or db.TrackQueries")
+		return
+	}
+	if n := stats.Count(); n > max {
+		t.Errorf("expect at most %d queries, got: %d\n%s", max, n, formatFingerprints(stats.Fingerprints()))
+	}
+}
+
+func formatFingerprints(fps []db.FingerprintCount) string {
+	var b strings.Builder
+	for _, fp := range fps {
+		fmt.Fprintf(&b, "  %4d  %s\n", fp.Count, fp.Fingerprint)
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/db"
+)
+
+type testBudgetModel struct {
+	ID   int64
+	Name string
+}
+
+// recordTB 记录断言失败, 不结束测试.
+type recordTB struct {
+	testing.TB
+	failed string
+}
+
+func (r *recordTB) Errorf(format string, args ...interface{}) {
+	r.failed = fmt.Sprintf(format, args...)
+}
+
+func TestMaxQueries(t *testing.T) {
+	dial := db.WithInitializeHook(func(opts *db.Options) (gorm.Dialector, error) {
+		return sqlite.Open(filepath.Join(t.TempDir(), opts.DBName)), nil
+	}, db.QueryBudgetHook)
+	source, err := (&db.Options{DBName: "budget.db"}).ToSource(dial, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := db.NewProvider(source)
+	ctx := TrackQueries(context.Background())
+	if err := p.UseDB(ctx).AutoMigrate(&testBudgetModel{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		p.UseDB(ctx).Find(&testBudgetModel{}, i)
+	}
+	n := db.QueryStatsFrom(ctx).Count()
+
+	MaxQueries(t, ctx, n)
+	r := &recordTB{TB: t}
+	MaxQueries(r, ctx, n-1)
+	if r.failed == "" {
+		t.Errorf("expect max queries failed")
+	}
+	t.Log(r.failed)
+}
@@ -0,0 +1,97 @@
+package dbtest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/db"
+)
+
+type testUser struct {
+	ID    int64
+	Name  string
+	Phone string `encrypt:"true"`
+}
+
+type testLog struct {
+	ID      int64
+	Message string
+}
+
+func testProvider(t *testing.T, hooks ...func(*gorm.DB) error) *db.TransProvider {
+	dial := db.WithInitializeHook(func(opts *db.Options) (gorm.Dialector, error) {
+		return sqlite.Open(filepath.Join(t.TempDir(), opts.DBName)), nil
+	}, hooks...)
+	source, err := (&db.Options{DBName: "dbtest.db"}).ToSource(dial, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := db.NewProvider(source)
+	if err := p.UseDB(context.Background()).AutoMigrate(&testUser{}, &testLog{}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFixtures(t *testing.T) {
+	encrypt := func(ctx context.Context, tag string, val string) (string, error) {
+		return "enc:" + val, nil
+	}
+	decrypt := func(ctx context.Context, tag string, val string) (string, error) {
+		return val[len("enc:"):], nil
+	}
+	p := testProvider(t, db.CryptoHook(encrypt, decrypt))
+	count := func(table string) int64 {
+		var n int64
+		if err := p.UseDB(context.Background()).Table(table).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	t.Run("load", func(t *testing.T) {
+		ctx := Rollback(t, context.Background(), p)
+		LoadFixtures(t, ctx, p, "testdata/fixtures.yml", &testUser{})
+
+		u := &testUser{}
+		if err := p.UseDB(ctx).First(u, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		if u.Name != "alice" || u.Phone != "13800000001" {
+			t.Errorf("unexpected user: %+v", u)
+		}
+		SnapshotTable(t, ctx, p, "test_users")
+		SnapshotTable(t, ctx, p, "test_logs")
+
+		var users []*testUser
+		if err := p.UseDB(ctx).Order("id").Find(&users).Error; err != nil {
+			t.Fatal(err)
+		}
+		Snapshot(t, "users", users)
+	})
+
+	if n := count("test_users") + count("test_logs"); n != 0 {
+		t.Errorf("expect rolled back, got: %d rows", n)
+	}
+
+	t.Run("nested transaction", func(t *testing.T) {
+		ctx := Rollback(t, context.Background(), p)
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			return p.UseDB(ctx).Create(&testLog{ID: 2, Message: "nested"}).Error
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := count("test_logs"); n != 0 {
+			t.Errorf("expect uncommitted, got: %d rows", n)
+		}
+	})
+
+	if n := count("test_logs"); n != 0 {
+		t.Errorf("expect rolled back, got: %d rows", n)
+	}
+}
@@ -0,0 +1,107 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/agztizoo/glue/db"
+)
+
+// LoadFixtures 加载 yaml 夹具文件, 按文件中的顺序写入各表.
+//
+// 文件格式为表名到行列表的映射, 行为列名到值的映射:
+//	users:
+//	  - id: 1
+//	    name: alice
+//	    phone: "13800000000"
+//
+// 表名与 models 中模型的表名相同时, 行转换为模型后写入, 数据库初始化插件(如
+// encrypt tag 字段加密)同样生效; 否则按列直接写入.
+//
+// 通过 p.UseWriteDB(ctx) 写入, ctx 为 Rollback 返回的 context 时随测试回滚.
+//
+// 例:
+//	ctx := dbtest.Rollback(t, context.Background(), provider)
+//	dbtest.LoadFixtures(t, ctx, provider, "testdata/users.yml", &User{})
+func LoadFixtures(t testing.TB, ctx context.Context, p db.Provider, file string, models ...interface{}) {
+	t.Helper()
+	if err := loadFixtures(ctx, p, file, models); err != nil {
+		t.Fatalf("load fixtures %s: %v", file, err)
+	}
+}
+
+func loadFixtures(ctx context.Context, p db.Provider, file string, models []interface{}) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return err
+	}
+	// 空文件.
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("expect mapping of table name to rows")
+	}
+
+	d := p.UseWriteDB(ctx)
+	schemas, err := parseModels(d, models)
+	if err != nil {
+		return err
+	}
+	// 保持文件中表的顺序, 便于处理外键依赖.
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		table := root.Content[i].Value
+		var rows []map[string]interface{}
+		if err := root.Content[i+1].Decode(&rows); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+		for _, row := range rows {
+			if err := insertRow(ctx, d, schemas[table], table, row); err != nil {
+				return fmt.Errorf("table %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseModels 返回表名到模型结构的映射.
+func parseModels(d *gorm.DB, models []interface{}) (map[string]*schema.Schema, error) {
+	schemas := make(map[string]*schema.Schema)
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: d}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		schemas[stmt.Schema.Table] = stmt.Schema
+	}
+	return schemas, nil
+}
+
+func insertRow(ctx context.Context, d *gorm.DB, s *schema.Schema, table string, row map[string]interface{}) error {
+	if s == nil {
+		return d.Table(table).Create(row).Error
+	}
+	rv := reflect.New(s.ModelType)
+	for column, value := range row {
+		field := s.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("unknown column: %s", column)
+		}
+		if err := field.Set(ctx, rv.Elem(), value); err != nil {
+			return fmt.Errorf("column %s: %w", column, err)
+		}
+	}
+	return d.Table(table).Create(rv.Interface()).Error
+}
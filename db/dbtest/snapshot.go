@@ -0,0 +1,77 @@
+package dbtest
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/agztizoo/glue/db"
+)
+
+// GoldenDir 快照文件目录, 相对于测试包目录.
+var GoldenDir = "testdata"
+
+var update = flag.Bool("dbtest.update", false, "update dbtest golden files")
+
+// Snapshot 断言 v 序列化为 yaml 后与快照文件 {GoldenDir}/{name}.golden.yml 一致.
+//
+// 使用 go test -dbtest.update 运行时更新快照文件.
+//
+// 例:
+//	var users []*User
+//	provider.UseDB(ctx).Order("id").Find(&users)
+//	dbtest.Snapshot(t, "users", users)
+func Snapshot(t testing.TB, name string, v interface{}) {
+	t.Helper()
+	got, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal snapshot %s: %v", name, err)
+	}
+	file := filepath.Join(GoldenDir, name+".golden.yml")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read snapshot %s: %v, run with -dbtest.update to create", name, err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("snapshot %s mismatch (-want +got):\n%s", name, diff)
+	}
+}
+
+// SnapshotTable 断言表内容与快照文件 {GoldenDir}/{测试名}.{table}.golden.yml 一致.
+//
+// 行按第一列排序, ignore 中的列(如: 自动生成的时间)不参与比较.
+// 表中保存的是加密后的值, 随机加密结果需忽略或读取模型后使用 Snapshot.
+func SnapshotTable(t testing.TB, ctx context.Context, p db.Provider, table string, ignore ...string) {
+	t.Helper()
+	var rows []map[string]interface{}
+	if err := p.UseDB(ctx).Table(table).Order("1").Find(&rows).Error; err != nil {
+		t.Fatalf("query table %s: %v", table, err)
+	}
+	for _, row := range rows {
+		for _, column := range ignore {
+			delete(row, column)
+		}
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+	}
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()) + "." + table
+	Snapshot(t, name, rows)
+}
@@ -0,0 +1,47 @@
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/agztizoo/glue/transaction"
+)
+
+var errRollback = errors.New("dbtest: rollback")
+
+// Rollback 开启事务并返回事务 context, 测试结束时回滚.
+//
+// 通过返回的 context 执行的语句(包括嵌套事务)在测试结束后回滚, 测试间互不影响.
+// 事务不会提交, OnCommitted 回调不执行; EscapeTransaction 中的语句不回滚.
+//
+// 例:
+//	ctx := dbtest.Rollback(t, context.Background(), provider)
+//	repo.Save(ctx, user)
+func Rollback(t testing.TB, ctx context.Context, tm transaction.Manager) context.Context {
+	t.Helper()
+	started := make(chan context.Context, 1)
+	done := make(chan struct{})
+	finished := make(chan error, 1)
+	go func() {
+		finished <- tm.Transaction(ctx, func(ctx context.Context) error {
+			started <- ctx
+			<-done
+			return errRollback
+		})
+	}()
+
+	select {
+	case tctx := <-started:
+		t.Cleanup(func() {
+			close(done)
+			if err := <-finished; !errors.Is(err, errRollback) {
+				t.Errorf("rollback transaction: %v", err)
+			}
+		})
+		return tctx
+	case err := <-finished:
+		t.Fatalf("begin transaction: %v", err)
+		return nil
+	}
+}
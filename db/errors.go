@@ -0,0 +1,154 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"gorm.io/gorm"
+)
+
+// 数据库错误分类, 通过 errors.Is 判断, 需安装 ErrorTranslateHook.
+//
+// ErrNotFound 即 gorm.ErrRecordNotFound, 无需安装, err == db.ErrNotFound 同样成立.
+var (
+	ErrNotFound            = gorm.ErrRecordNotFound
+	ErrDuplicateKey        = errors.New("duplicate key")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrDeadlock            = errors.New("deadlock")
+	ErrLockTimeout         = errors.New("lock wait timeout")
+	ErrConnection          = errors.New("database connection error")
+)
+
+const errorTranslatorName = "glue:error_translator"
+
+// Error 代表已分类的数据库错误.
+//
+// 错误信息与原始错误相同, 原始错误可通过 errors.Is, errors.As 获取.
+//
+// 例:
+//	var e *db.Error
+//	if errors.As(err, &e) && errors.Is(err, db.ErrDuplicateKey) {
+//		log.Printf("duplicate key: %s", e.Constraint)
+//	}
+type Error struct {
+	// 错误分类, 如: ErrDuplicateKey.
+	Kind error
+	// 约束或索引名, 未知时为空.
+	//
+	// sqlite 不返回约束名, 为冲突的列, 如: users.email.
+	Constraint string
+	// 原始错误.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 实现 errors.Is 按分类判断.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// ErrorTranslator 分类方言驱动错误, 无法识别时返回 nil.
+type ErrorTranslator func(err error) *Error
+
+// ErrorTranslateHook 实现数据库初始化时, 注入数据库错误分类.
+//
+// 1. 语句执行错误与 TransProvider 事务提交错误转换为 *Error.
+// 2. translators 依次尝试, 均无法识别时按通用规则分类:
+//    连接错误为 ErrConnection, gorm 内置的 ErrDuplicatedKey, ErrForeignKeyViolated 分别对应.
+// 3. 无法分类的错误与 ErrNotFound(gorm.ErrRecordNotFound) 保持不变, err == ErrNotFound 仍然成立.
+// 4. 重复安装时合并 translators, mysql.Dialector 已默认安装.
+//
+// 例:
+//	dial := WithInitializeHook(xxx.Dialector, ErrorTranslateHook(mysql.TranslateError))
+func ErrorTranslateHook(translators ...ErrorTranslator) func(*gorm.DB) error {
+	return func(db *gorm.DB) error {
+		// 重复安装时合并 translators.
+		if t, ok := db.Config.Plugins[errorTranslatorName].(*errorTranslator); ok {
+			t.translators = append(t.translators, translators...)
+			return nil
+		}
+		return db.Use(&errorTranslator{translators: translators})
+	}
+}
+
+// errorTranslator 实现 gorm.Plugin, 注册在数据库上, 用于事务提交错误分类.
+type errorTranslator struct {
+	translators []ErrorTranslator
+}
+
+func (t *errorTranslator) Name() string {
+	return errorTranslatorName
+}
+
+func (t *errorTranslator) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []func(string, func(*gorm.DB)) error{
+		cb.Create().After("*").Register,
+		cb.Query().After("*").Register,
+		cb.Update().After("*").Register,
+		cb.Delete().After("*").Register,
+		cb.Row().After("*").Register,
+		cb.Raw().After("*").Register,
+	}
+	for _, register := range processors {
+		if err := register("glue:error_translate", t.callback); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *errorTranslator) callback(db *gorm.DB) {
+	if db.Error != nil {
+		db.Error = t.translate(db.Error)
+	}
+}
+
+func (t *errorTranslator) translate(err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	for _, translate := range t.translators {
+		if e := translate(err); e != nil {
+			return e
+		}
+	}
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return &Error{Kind: ErrDuplicateKey, Err: err}
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return &Error{Kind: ErrForeignKeyViolation, Err: err}
+	case isConnectionError(err):
+		return &Error{Kind: ErrConnection, Err: err}
+	}
+	return err
+}
+
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// translateError 使用数据库上注册的 ErrorTranslateHook 分类错误, 未注册时保持不变.
+func translateError(db *gorm.DB, err error) error {
+	if err == nil {
+		return nil
+	}
+	if t, ok := db.Config.Plugins[errorTranslatorName].(*errorTranslator); ok {
+		return t.translate(err)
+	}
+	return err
+}
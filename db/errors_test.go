@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type TestErrorModel struct {
+	ID    int64
+	Email string `gorm:"uniqueIndex"`
+}
+
+func TestErrorTranslateHook(t *testing.T) {
+	// 模拟方言 translator.
+	translate := func(err error) *Error {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return &Error{Kind: ErrDuplicateKey, Constraint: "email", Err: err}
+		}
+		return nil
+	}
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), ErrorTranslateHook(translate)), "errors")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestErrorModel{}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		// 保持 gorm.ErrRecordNotFound, 兼容 == 判断.
+		err := p.UseDB(ctx).First(&TestErrorModel{}, 1).Error
+		if err != gorm.ErrRecordNotFound || err != ErrNotFound || !errors.Is(err, ErrNotFound) {
+			t.Errorf("expect: %v, got: %#v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("duplicate key", func(t *testing.T) {
+		if err := p.UseDB(ctx).Create(&TestErrorModel{ID: 1, Email: "a"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		err := p.UseDB(ctx).Create(&TestErrorModel{ID: 2, Email: "a"}).Error
+		var e *Error
+		if !errors.Is(err, ErrDuplicateKey) || !errors.As(err, &e) || e.Constraint != "email" {
+			t.Fatalf("expect duplicate key, got: %v", err)
+		}
+		if errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("unexpected kind: %v", e.Kind)
+		}
+		if err.Error() != e.Err.Error() {
+			t.Errorf("expect original message, got: %s", err.Error())
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			err := p.UseDB(ctx).Create(&TestErrorModel{ID: 3, Email: "a"}).Error
+			return errors.Unwrap(err)
+		})
+		if !errors.Is(err, ErrDuplicateKey) {
+			t.Errorf("expect duplicate key, got: %v", err)
+		}
+		err = p.Transaction(ctx, func(ctx context.Context) error {
+			return errors.New("rollback")
+		})
+		if err == nil || err.Error() != "rollback" {
+			t.Errorf("expect error unchanged, got: %v", err)
+		}
+	})
+
+	t.Run("without hook", func(t *testing.T) {
+		p := testdb_newprovider(t, "errors_without_hook")
+		err := p.UseDB(ctx).First(&TestDBModel{}, 1).Error
+		var e *Error
+		if errors.As(err, &e) {
+			t.Errorf("expect untranslated, got: %v", e.Kind)
+		}
+	})
+}
@@ -3,10 +3,10 @@ package db
 import (
 	"context"
 	"fmt"
-	"reflect"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 // WithInitializeHook 实现 gorm.Dialector Initialize 方法 Hook 能力.
@@ -43,39 +43,97 @@ func (h *initializeHook) Initialize(db *gorm.DB) error {
 	return nil
 }
 
+// SavePoint 实现 gorm.SavePointerDialectorInterface, 支持嵌套事务.
+func (h *initializeHook) SavePoint(tx *gorm.DB, name string) error {
+	if sp, ok := h.Dialector.(gorm.SavePointerDialectorInterface); ok {
+		return sp.SavePoint(tx, name)
+	}
+	return gorm.ErrUnsupportedDriver
+}
+
+// RollbackTo 实现 gorm.SavePointerDialectorInterface, 支持嵌套事务.
+func (h *initializeHook) RollbackTo(tx *gorm.DB, name string) error {
+	if sp, ok := h.Dialector.(gorm.SavePointerDialectorInterface); ok {
+		return sp.RollbackTo(tx, name)
+	}
+	return gorm.ErrUnsupportedDriver
+}
+
 // 连接池默认配置.
 var (
 	DefaultMaxIdleConns    = 100
 	DefaultMaxOpenConns    = 200
 	DefaultConnMaxLifeTime = 300 * time.Second
+	DefaultConnMaxIdleTime = 300 * time.Second
 )
 
 // ConnPoolHook 实现数据库初始化时, 连接池初始化.
 //
+// connMaxLifeTime 同时作为连接最大生命周期与最大空闲时间.
+//
 // https://github.com/go-sql-driver/mysql#important-settings
 func ConnPoolHook(maxIdleConns, maxOpenConns int, connMaxLifeTime time.Duration) func(*gorm.DB) error {
+	return ConnPoolHookWithIdleTime(maxIdleConns, maxOpenConns, connMaxLifeTime, connMaxLifeTime)
+}
+
+// ConnPoolHookWithIdleTime 实现数据库初始化时, 连接池初始化.
+//
+// 分别设置连接最大生命周期与最大空闲时间, 小于等于 0 时使用默认配置.
+func ConnPoolHookWithIdleTime(maxIdleConns, maxOpenConns int, connMaxLifeTime, connMaxIdleTime time.Duration) func(*gorm.DB) error {
+	if maxIdleConns <= 0 {
+		maxIdleConns = DefaultMaxIdleConns
+	}
+	if maxOpenConns <= 0 {
+		maxOpenConns = DefaultMaxOpenConns
+	}
+	if connMaxLifeTime <= 0 {
+		connMaxLifeTime = DefaultConnMaxLifeTime
+	}
+	if connMaxIdleTime <= 0 {
+		connMaxIdleTime = DefaultConnMaxIdleTime
+	}
 	return func(db *gorm.DB) error {
 		d, err := db.DB()
 		if err != nil {
 			return err
 		}
-
-		if maxIdleConns <= 0 {
-			maxIdleConns = DefaultMaxIdleConns
-		}
-		if maxOpenConns <= 0 {
-			maxOpenConns = DefaultMaxOpenConns
-		}
-		if connMaxLifeTime <= 0 {
-			connMaxLifeTime = DefaultConnMaxLifeTime
-		}
 		d.SetMaxIdleConns(maxIdleConns)
 		d.SetMaxOpenConns(maxOpenConns)
+		d.SetConnMaxLifetime(connMaxLifeTime)
 		// 兼容 go1.4
 		if s, ok := (interface{}(d)).(interface {
 			SetConnMaxIdleTime(time.Duration)
 		}); ok {
-			s.SetConnMaxIdleTime(connMaxLifeTime)
+			s.SetConnMaxIdleTime(connMaxIdleTime)
+		}
+		return nil
+	}
+}
+
+// optionsConnPoolHook 按数据库配置初始化连接池.
+//
+// 仅设置配置中非零的连接池参数, 未配置参数保持驱动或 Dialector 的设置.
+func optionsConnPoolHook(opts *Options) func(*gorm.DB) error {
+	return func(db *gorm.DB) error {
+		d, err := db.DB()
+		if err != nil {
+			return err
+		}
+		if opts.MaxIdleConns > 0 {
+			d.SetMaxIdleConns(int(opts.MaxIdleConns))
+		}
+		if opts.MaxOpenConns > 0 {
+			d.SetMaxOpenConns(int(opts.MaxOpenConns))
+		}
+		if lt := opts.ConnMaxLifetime(); lt > 0 {
+			d.SetConnMaxLifetime(lt)
+		}
+		if it := opts.ConnMaxIdleTime(); it > 0 {
+			if s, ok := (interface{}(d)).(interface {
+				SetConnMaxIdleTime(time.Duration)
+			}); ok {
+				s.SetConnMaxIdleTime(it)
+			}
 		}
 		return nil
 	}
@@ -127,43 +185,37 @@ func (p *TagProcessor) loopFields(db *gorm.DB, handler TagHandler) {
 		return
 	}
 
+	var fields []*schema.Field
 	for _, field := range db.Statement.Schema.Fields {
-		tagValue, ok := field.Tag.Lookup(p.tagName)
-		if !ok {
-			continue
+		if _, ok := field.Tag.Lookup(p.tagName); ok {
+			fields = append(fields, field)
 		}
-		switch db.Statement.ReflectValue.Kind() {
-		case reflect.Slice, reflect.Array:
-			for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
-				fieldValue, isZero := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue.Index(i))
-				fieldValue, ok, err := handler(db.Statement.Context, tagValue, fieldValue, isZero)
-				if err != nil {
-					db.AddError(err)
-					return
-				}
-				if !ok {
-					continue
-				}
-				if err := field.Set(db.Statement.Context, db.Statement.ReflectValue.Index(i), fieldValue); err != nil {
-					db.AddError(err)
-					return
-				}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	err := walkRecords(db, func(r record) error {
+		for _, field := range fields {
+			fieldValue, isZero, ok := r.get(field)
+			if !ok {
+				continue
 			}
-		case reflect.Struct:
-			fieldValue, isZero := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue)
-			fieldValue, ok, err := handler(db.Statement.Context, tagValue, fieldValue, isZero)
+			fieldValue, ok, err := handler(db.Statement.Context, field.Tag.Get(p.tagName), fieldValue, isZero)
 			if err != nil {
-				db.AddError(err)
-				return
+				return err
 			}
 			if !ok {
 				continue
 			}
-			if err := field.Set(db.Statement.Context, db.Statement.ReflectValue, fieldValue); err != nil {
-				db.AddError(err)
-				return
+			if err := r.set(field, fieldValue); err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		db.AddError(err)
 	}
 }
 
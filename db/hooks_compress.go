@@ -0,0 +1,110 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"gorm.io/gorm"
+)
+
+var (
+	CompressTagName = "compress"
+
+	ErrInvalidCompressed = errors.New("invalid compressed data")
+)
+
+// CompressHook 实现大文本字段压缩.
+//
+// 支持的压缩字段类型：string, *string, []byte
+//
+// 写入前压缩并 base64 编码, 读取后解压. 空字符串与空指针不做处理.
+// 与加密同时使用时, 先压缩后加密, 先解密后解压.
+//
+// 例:
+//	type Article struct {
+//		Content string `compress:"gzip"`
+//	}
+//	dial := WithInitializeHook(xxx.Dialector, CompressHook())
+func CompressHook() func(*gorm.DB) error {
+	p := NewTagProcessor(
+		CompressTagName,
+		WrapStringTagHandler(NonEmptyStringTagHandler(CompressTagHandler)),
+		WrapStringTagHandler(NonEmptyStringTagHandler(DecompressTagHandler)))
+	return func(db *gorm.DB) error {
+		if err := registerWriteFieldCallback(db, CompressFieldCallback, p.Marshal); err != nil {
+			return err
+		}
+		return registerReadFieldCallback(db, DecompressFieldCallback, p.Unmarshal, true)
+	}
+}
+
+// CompressTagHandler 处理字段压缩.
+//
+// tag    | 算法
+// ""     | GZIP
+// "true" | GZIP
+// "gzip" | GZIP
+func CompressTagHandler(ctx context.Context, tagValue string, fieldValue string) (string, error) {
+	switch tagValue {
+	case "", "true", "gzip":
+		compressed, err := GzipCompress([]byte(fieldValue))
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(compressed), nil
+	default:
+		return "", fmt.Errorf("compress algorithm: %s not support", tagValue)
+	}
+}
+
+// DecompressTagHandler 处理字段解压.
+func DecompressTagHandler(ctx context.Context, tagValue string, fieldValue string) (string, error) {
+	switch tagValue {
+	case "", "true", "gzip":
+		compressed, err := base64.StdEncoding.DecodeString(fieldValue)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidCompressed, err)
+		}
+		raw, err := GzipDecompress(compressed)
+		if err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	default:
+		return "", fmt.Errorf("compress algorithm: %s not support", tagValue)
+	}
+}
+
+// GzipCompress 使用 gzip 压缩数据.
+//
+// 不写入文件名和修改时间, 相同输入输出相同.
+func GzipCompress(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GzipDecompress 解压 gzip 数据.
+func GzipDecompress(compressed []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCompressed, err)
+	}
+	defer r.Close()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCompressed, err)
+	}
+	return raw, nil
+}
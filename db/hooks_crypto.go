@@ -5,9 +5,12 @@ import (
 	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -16,6 +19,18 @@ var (
 	EncryptTagName = "encrypt"
 
 	ErrEncryptKeyNotFound = errors.New("encrypt key not found")
+
+	ErrInvalidCiphertext            = errors.New("invalid ciphertext")
+	ErrCiphertextAuthFailed         = errors.New("ciphertext authentication failed")
+	ErrUnsupportedCiphertextVersion = errors.New("unsupported ciphertext version")
+)
+
+// AES-GCM 密文格式版本.
+const (
+	// gcmEnvelopeV1 格式: version(1) | nonce(12) | ciphertext | tag(16).
+	gcmEnvelopeV1 byte = 1
+	// gcmEnvelopeV2 格式: version(1) | len(key id)(1) | key id | nonce(12) | ciphertext | tag(16).
+	gcmEnvelopeV2 byte = 2
 )
 
 // CryptoHook 实现数据库加解密能力初始化注入.
@@ -47,29 +62,77 @@ var (
 //	dial := WithInitializeHook(xxx.Dialector, cryptoHook)
 //	dbs := dbopts.OpenDBs(dial, &gorm.Config{})
 //  provider := NewProvider(dbs, keyf, scopes...)
-func CryptoHook(encrypt, decrypt StringTagHandler) func(*gorm.DB) error {
+//
+// tag 值格式为 "算法;选项:值", 加解密处理程序只接收算法部分.
+// 如: encrypt:"aes;index:email_bidx" 参考 WithBlindIndex.
+func CryptoHook(encrypt, decrypt StringTagHandler, opts ...CryptoOption) func(*gorm.DB) error {
+	co := &cryptoOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
 	p := NewTagProcessor(
 		EncryptTagName,
 		// 空字符串加密.
-		WrapStringTagHandler(encrypt),
+		WrapStringTagHandler(encryptAlgorithmTagHandler(encrypt)),
 		// 空字符串不解密, 不可解密报错.
-		WrapStringTagHandler(NonEmptyStringTagHandler(decrypt)))
+		WrapStringTagHandler(NonEmptyStringTagHandler(encryptAlgorithmTagHandler(decrypt))))
 	return func(db *gorm.DB) error {
-		db.Callback().Create().Before("gorm:create").Register("glue:encrypt_field", p.Marshal)
-		db.Callback().Create().After("gorm:create").Register("glue:decrypt_field", p.Unmarshal)
-		db.Callback().Update().Before("gorm:update").Register("glue:encrypt_field", p.Marshal)
-		db.Callback().Update().After("gorm:update").Register("glue:decrypt_field", p.Unmarshal)
-		db.Callback().Query().After("gorm:query").Register("glue:decrypt_field", p.Unmarshal)
+		if err := registerWriteFieldCallback(db, EncryptFieldCallback, p.Marshal); err != nil {
+			return err
+		}
+		if err := registerReadFieldCallback(db, DecryptFieldCallback, p.Unmarshal, true); err != nil {
+			return err
+		}
+		if co.blindIndex != nil {
+			return co.blindIndex.register(db)
+		}
 		return nil
 	}
 }
 
-// EncryptTagHandler 处理字段解密.
+// CryptoOption 代表 CryptoHook 选项.
+type CryptoOption func(*cryptoOptions)
+
+type cryptoOptions struct {
+	blindIndex *blindIndex
+}
+
+// parseEncryptTag 解析 encrypt tag 值.
+//
+// 格式: 算法;选项:值;选项:值
+func parseEncryptTag(tagValue string) (string, map[string]string) {
+	parts := strings.Split(tagValue, ";")
+	opts := make(map[string]string)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, ":", 2)
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			continue
+		}
+		if len(kv) == 2 {
+			opts[key] = strings.TrimSpace(kv[1])
+		} else {
+			opts[key] = ""
+		}
+	}
+	return strings.TrimSpace(parts[0]), opts
+}
+
+// encryptAlgorithmTagHandler 去除 tag 值中的选项, 只传递算法.
+func encryptAlgorithmTagHandler(handler StringTagHandler) StringTagHandler {
+	return func(ctx context.Context, tagValue string, fieldValue string) (string, error) {
+		algorithm, _ := parseEncryptTag(tagValue)
+		return handler(ctx, algorithm, fieldValue)
+	}
+}
+
+// EncryptTagHandler 处理字段加密.
 //
-// tag    | 算法
-// ""       AES
-// "true" | AES
-// "aes"  | AES
+// tag       | 算法
+// ""        | AES
+// "true"    | AES
+// "aes"     | AES
+// "aes-gcm" | AES-GCM, 随机 nonce, 密文带版本号
 func EncryptTagHandler(keyf func(ctx context.Context) (string, error)) StringTagHandler {
 	return func(ctx context.Context, tagValue string, fieldValue string) (string, error) {
 		aesKey, err := keyf(ctx)
@@ -89,6 +152,12 @@ func EncryptTagHandler(keyf func(ctx context.Context) (string, error)) StringTag
 			}
 			// 将加密后的字符数据用base64编码成字符串
 			return base64.StdEncoding.EncodeToString(encrypted), nil
+		case "aes-gcm":
+			encrypted, err := AESGCMEncrypt([]byte(fieldValue), []byte(aesKey))
+			if err != nil {
+				return "", err
+			}
+			return base64.StdEncoding.EncodeToString(encrypted), nil
 		default:
 			return "", fmt.Errorf("encrypt algorithm: %s not support", tagValue)
 		}
@@ -97,10 +166,11 @@ func EncryptTagHandler(keyf func(ctx context.Context) (string, error)) StringTag
 
 // DecryptTagHandler 处理字段解密.
 //
-// tag    | 算法
-// ""       AES
-// "true" | AES
-// "aes"  | AES
+// tag       | 算法
+// ""        | AES
+// "true"    | AES
+// "aes"     | AES
+// "aes-gcm" | AES-GCM, 密文被篡改时返回 ErrCiphertextAuthFailed
 func DecryptTagHandler(keyf func(ctx context.Context) (string, error)) StringTagHandler {
 	return func(ctx context.Context, tagValue string, fieldValue string) (string, error) {
 		aesKey, err := keyf(ctx)
@@ -124,6 +194,16 @@ func DecryptTagHandler(keyf func(ctx context.Context) (string, error)) StringTag
 				return "", err
 			}
 			return string(decrypted), nil
+		case "aes-gcm":
+			encrypted, err := base64.StdEncoding.DecodeString(fieldValue)
+			if err != nil {
+				return "", err
+			}
+			decrypted, err := AESGCMDecrypt(encrypted, []byte(aesKey))
+			if err != nil {
+				return "", err
+			}
+			return string(decrypted), nil
 		default:
 			return "", fmt.Errorf("encrypt algorithm: %s not support", tagValue)
 		}
@@ -131,6 +211,9 @@ func DecryptTagHandler(keyf func(ctx context.Context) (string, error)) StringTag
 }
 
 // AESEncrypt 实现 aes 加密字节数组.
+//
+// CBC 模式, 使用密钥前 16 字节作为 IV, 支持 16, 24, 32 字节密钥.
+// 密钥长度不合法时返回错误.
 func AESEncrypt(original, aesKey []byte) ([]byte, error) {
 	block, err := aes.NewCipher(aesKey)
 	if err != nil {
@@ -140,25 +223,132 @@ func AESEncrypt(original, aesKey []byte) ([]byte, error) {
 	original = padding(original, block.BlockSize())
 	encrypted := make([]byte, len(original))
 
-	blockMode := cipher.NewCBCEncrypter(block, aesKey)
+	blockMode := cipher.NewCBCEncrypter(block, aesKey[:block.BlockSize()])
 	blockMode.CryptBlocks(encrypted, original)
 	return encrypted, nil
 }
 
 // AESDecrypt 实现 aes 算法解密字节.
+//
+// 使用密钥前 16 字节作为 IV, 与 AESEncrypt 对应.
+// 密文长度或填充不合法时返回 ErrInvalidCiphertext.
 func AESDecrypt(encrypted, aesKey []byte) ([]byte, error) {
 	block, err := aes.NewCipher(aesKey)
 	if err != nil {
 		return nil, err
 	}
+	if len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return nil, ErrInvalidCiphertext
+	}
 	decrypted := make([]byte, len(encrypted))
-	blockMode := cipher.NewCBCDecrypter(block, aesKey)
+	blockMode := cipher.NewCBCDecrypter(block, aesKey[:block.BlockSize()])
 	blockMode.CryptBlocks(decrypted, encrypted)
 
-	decrypted = unPadding(decrypted)
+	return unPadding(decrypted, block.BlockSize())
+}
+
+// AESGCMEncrypt 实现 aes-gcm 加密字节数组.
+//
+// 每次加密使用随机 nonce, 返回带版本号的密文:
+//   version(1) | nonce(12) | ciphertext | tag(16)
+func AESGCMEncrypt(original, aesKey []byte) ([]byte, error) {
+	return sealGCM([]byte{gcmEnvelopeV1}, original, aesKey)
+}
+
+// AESGCMEncryptWithKeyID 实现 aes-gcm 加密字节数组, 密文中记录密钥 ID.
+//
+// 每次加密使用随机 nonce, 返回带版本号的密文:
+//   version(1) | len(key id)(1) | key id | nonce(12) | ciphertext | tag(16)
+func AESGCMEncryptWithKeyID(original []byte, keyID string, aesKey []byte) ([]byte, error) {
+	if keyID == "" || len(keyID) > 255 {
+		return nil, fmt.Errorf("invalid key id length: %d", len(keyID))
+	}
+	header := append([]byte{gcmEnvelopeV2, byte(len(keyID))}, keyID...)
+	return sealGCM(header, original, aesKey)
+}
+
+// AESGCMDecrypt 实现 aes-gcm 解密字节数组.
+//
+// 支持 AESGCMEncrypt 与 AESGCMEncryptWithKeyID 的密文, aesKey 需与密文中的
+// 密钥 ID 对应.
+//
+// 密文格式不合法返回 ErrInvalidCiphertext, 版本不支持返回
+// ErrUnsupportedCiphertextVersion, 密文被篡改返回 ErrCiphertextAuthFailed.
+func AESGCMDecrypt(envelope, aesKey []byte) ([]byte, error) {
+	_, header, err := parseGCMHeader(envelope)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	body := envelope[len(header):]
+	if len(body) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce := body[:aead.NonceSize()]
+	decrypted, err := aead.Open(nil, nonce, body[aead.NonceSize():], header)
+	if err != nil {
+		return nil, ErrCiphertextAuthFailed
+	}
 	return decrypted, nil
 }
 
+// GCMCiphertextKeyID 返回 aes-gcm 密文中记录的密钥 ID.
+//
+// AESGCMEncrypt 生成的密文不记录密钥 ID, 返回空字符串.
+func GCMCiphertextKeyID(envelope []byte) (string, error) {
+	keyID, _, err := parseGCMHeader(envelope)
+	return keyID, err
+}
+
+// parseGCMHeader 解析密文头, 返回密钥 ID 与密文头.
+func parseGCMHeader(envelope []byte) (string, []byte, error) {
+	if len(envelope) == 0 {
+		return "", nil, ErrInvalidCiphertext
+	}
+	switch envelope[0] {
+	case gcmEnvelopeV1:
+		return "", envelope[:1], nil
+	case gcmEnvelopeV2:
+		if len(envelope) < 2 {
+			return "", nil, ErrInvalidCiphertext
+		}
+		n := 2 + int(envelope[1])
+		if envelope[1] == 0 || len(envelope) < n {
+			return "", nil, ErrInvalidCiphertext
+		}
+		return string(envelope[2:n]), envelope[:n], nil
+	default:
+		return "", nil, ErrUnsupportedCiphertextVersion
+	}
+}
+
+// sealGCM 使用随机 nonce 加密, header 作为附加认证数据.
+func sealGCM(header, original, aesKey []byte) ([]byte, error) {
+	aead, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	envelope := make([]byte, 0, len(header)+len(nonce)+len(original)+aead.Overhead())
+	envelope = append(envelope, header...)
+	envelope = append(envelope, nonce...)
+	return aead.Seal(envelope, nonce, original, header), nil
+}
+
+func newGCM(aesKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
 func padding(src []byte, blockSize int) []byte {
 	// 取值1~blockSize，保证padNum被放在串里面了。
 	padNum := blockSize - len(src)%blockSize
@@ -166,8 +356,14 @@ func padding(src []byte, blockSize int) []byte {
 	return append(src, pad...)
 }
 
-func unPadding(src []byte) []byte {
+func unPadding(src []byte, blockSize int) ([]byte, error) {
 	n := len(src)
+	if n == 0 {
+		return nil, ErrInvalidCiphertext
+	}
 	unPaddingNum := int(src[n-1])
-	return src[:n-unPaddingNum]
+	if unPaddingNum == 0 || unPaddingNum > blockSize || unPaddingNum > n {
+		return nil, ErrInvalidCiphertext
+	}
+	return src[:n-unPaddingNum], nil
 }
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// BlindIndexTagOption encrypt tag 中盲索引选项名.
+	BlindIndexTagOption = "index"
+
+	ErrBlindIndexNotConfigured = errors.New("blind index not configured")
+)
+
+const blindIndexPluginName = "glue:blind_index"
+
+// WithBlindIndex 开启加密字段盲索引.
+//
+// 对 encrypt:"aes;index:email_bidx" 标记的字段, 创建和更新时使用 keyf 返回的密钥
+// 计算明文的 HMAC, 写入影子字段 email_bidx. 影子字段需要在模型中定义.
+//
+// 配合 WhereEncrypted 按明文检索加密字段.
+//
+// 例:
+//	type User struct {
+//		Email     string `encrypt:"aes;index:email_bidx"`
+//		EmailBidx string
+//	}
+//	cryptoHook := CryptoHook(encrypt, decrypt, WithBlindIndex(aesKeyFunc))
+//	provider.UseDB(ctx).Scopes(WhereEncrypted("email", "a@b.com")).First(&user)
+func WithBlindIndex(keyf func(ctx context.Context) (string, error)) CryptoOption {
+	return func(o *cryptoOptions) {
+		o.blindIndex = &blindIndex{keyf: keyf}
+	}
+}
+
+// BlindIndex 计算盲索引.
+//
+// 使用 key 派生的独立密钥计算 value 的 HMAC-SHA256, 返回十六进制字符串.
+func BlindIndex(key, value string) string {
+	dk := hmac.New(sha256.New, []byte(key))
+	dk.Write([]byte(blindIndexPluginName))
+	mac := hmac.New(sha256.New, dk.Sum(nil))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// blindIndex 实现盲索引计算.
+//
+// 同时作为 gorm.Plugin 保存在 gorm.Config 中, 供 WhereEncrypted 获取密钥.
+type blindIndex struct {
+	keyf func(ctx context.Context) (string, error)
+}
+
+var _ gorm.Plugin = new(blindIndex)
+
+// Name 实现 gorm.Plugin.
+func (b *blindIndex) Name() string {
+	return blindIndexPluginName
+}
+
+// Initialize 实现 gorm.Plugin.
+func (b *blindIndex) Initialize(db *gorm.DB) error {
+	return b.register(db)
+}
+
+// register 注册盲索引回调, 在字段规范化后, 压缩和加密前执行.
+func (b *blindIndex) register(db *gorm.DB) error {
+	db.Config.Plugins[b.Name()] = b
+	return registerWriteFieldCallback(db, BlindIndexFieldCallback, b.Marshal)
+}
+
+// index 计算字段值的盲索引.
+func (b *blindIndex) index(ctx context.Context, value interface{}) (string, bool, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case *string:
+		if v == nil {
+			return "", false, nil
+		}
+		s = *v
+	case []byte:
+		if v == nil {
+			return "", false, nil
+		}
+		s = string(v)
+	default:
+		if value == nil {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("non-stringable type: %T", value)
+	}
+	key, err := b.keyf(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	if key == "" {
+		return "", false, ErrEncryptKeyNotFound
+	}
+	return BlindIndex(key, s), true, nil
+}
+
+// Marshal 计算盲索引并写入影子字段.
+//
+// 支持的语句形态同 TagProcessor, 更新 map 时写入影子字段列.
+func (b *blindIndex) Marshal(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	type indexField struct {
+		field, shadow *schema.Field
+	}
+	var fields []indexField
+	for _, field := range db.Statement.Schema.Fields {
+		if shadow := blindIndexField(db.Statement.Schema, field); shadow != nil {
+			fields = append(fields, indexField{field: field, shadow: shadow})
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	ctx := db.Statement.Context
+	err := walkRecords(db, func(r record) error {
+		for _, f := range fields {
+			value, _, ok := r.get(f.field)
+			if !ok {
+				continue
+			}
+			idx, ok, err := b.index(ctx, value)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := r.set(f.shadow, idx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.AddError(err)
+	}
+}
+
+// blindIndexField 返回加密字段对应的影子字段, 未配置盲索引返回 nil.
+func blindIndexField(sch *schema.Schema, field *schema.Field) *schema.Field {
+	tagValue, ok := field.Tag.Lookup(EncryptTagName)
+	if !ok {
+		return nil
+	}
+	_, opts := parseEncryptTag(tagValue)
+	name, ok := opts[BlindIndexTagOption]
+	if !ok || name == "" {
+		return nil
+	}
+	return sch.LookUpField(name)
+}
+
+// WhereEncrypted 创建按加密字段明文检索的 Scope.
+//
+// field 为字段名或列名, 字段需配置盲索引. 参考 WithBlindIndex.
+//
+// 使用 context 对应的密钥计算 value 的盲索引, 并检索影子字段.
+// 字段标记 normalize tag 时, 先对 value 规范化.
+func WhereEncrypted(field string, value string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		plugin, ok := db.Config.Plugins[blindIndexPluginName].(*blindIndex)
+		if !ok {
+			db.AddError(ErrBlindIndexNotConfigured)
+			return db
+		}
+		model := db.Statement.Model
+		if model == nil {
+			model = db.Statement.Dest
+		}
+		if err := db.Statement.Parse(model); err != nil {
+			db.AddError(err)
+			return db
+		}
+		f := db.Statement.Schema.LookUpField(field)
+		if f == nil {
+			db.AddError(fmt.Errorf("field %s not found in %s", field, db.Statement.Schema.Name))
+			return db
+		}
+		shadow := blindIndexField(db.Statement.Schema, f)
+		if shadow == nil {
+			db.AddError(fmt.Errorf("field %s: %w", field, ErrBlindIndexNotConfigured))
+			return db
+		}
+		if rules, ok := f.Tag.Lookup(NormalizeTagName); ok {
+			normalized, err := NormalizeTagHandler(db.Statement.Context, rules, value)
+			if err != nil {
+				db.AddError(err)
+				return db
+			}
+			value = normalized
+		}
+		idx, _, err := plugin.index(db.Statement.Context, value)
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+		return db.Where(clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: shadow.DBName},
+			Value:  idx,
+		})
+	}
+}
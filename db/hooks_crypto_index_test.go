@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type TestBlindIndexModel struct {
+	ID        int64
+	Email     string `encrypt:"aes-gcm;index:email_bidx"`
+	EmailBidx string
+}
+
+func testdb_newprovider_blind_index(t *testing.T, name string) *TransProvider {
+	aesKey := func(ctx context.Context) (string, error) {
+		tenant, _ := ctx.Value("tenant").(string)
+		return strings.Repeat(tenant, 16)[:16], nil
+	}
+	hook := CryptoHook(EncryptTagHandler(aesKey), DecryptTagHandler(aesKey), WithBlindIndex(aesKey))
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), hook), name)
+	if err := p.UseDB(context.Background()).AutoMigrate(&TestBlindIndexModel{}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestBlindIndex(t *testing.T) {
+	p := testdb_newprovider_blind_index(t, "blind_index")
+	ctx := context.WithValue(context.Background(), "tenant", "a")
+
+	t.Run("insert", func(t *testing.T) {
+		m := &TestBlindIndexModel{ID: 1, Email: "a@example.com"}
+		if err := p.UseDB(ctx).Create(m).Error; err != nil {
+			t.Fatal(err)
+		}
+		if m.EmailBidx != BlindIndex("aaaaaaaaaaaaaaaa", "a@example.com") {
+			t.Errorf("unexpected blind index: %s", m.EmailBidx)
+		}
+		if m.Email != "a@example.com" {
+			t.Errorf("expect decrypted after create, got: %s", m.Email)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		got := &TestBlindIndexModel{}
+		if err := p.UseDB(ctx).Scopes(WhereEncrypted("email", "a@example.com")).First(got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != 1 || got.Email != "a@example.com" {
+			t.Errorf("unexpected model: %+v", got)
+		}
+
+		var n int64
+		p.UseDB(ctx).Model(&TestBlindIndexModel{}).Scopes(WhereEncrypted("Email", "b@example.com")).Count(&n)
+		if n != 0 {
+			t.Errorf("expect not found, got: %d", n)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		m := &TestBlindIndexModel{}
+		if err := p.UseDB(ctx).First(m, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		m.Email = "b@example.com"
+		if err := p.UseDB(ctx).Save(m).Error; err != nil {
+			t.Fatal(err)
+		}
+		got := &TestBlindIndexModel{}
+		if err := p.UseDB(ctx).Scopes(WhereEncrypted("email", "b@example.com")).First(got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != 1 {
+			t.Errorf("unexpected model: %+v", got)
+		}
+	})
+
+	t.Run("update map", func(t *testing.T) {
+		m := &TestBlindIndexModel{ID: 1}
+		if err := p.UseDB(ctx).Model(m).Updates(map[string]interface{}{"email": "c@example.com"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		got := &TestBlindIndexModel{}
+		if err := p.UseDB(ctx).Scopes(WhereEncrypted("email", "c@example.com")).First(got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != 1 || got.Email != "c@example.com" {
+			t.Errorf("unexpected model: %+v", got)
+		}
+	})
+
+	t.Run("other tenant key", func(t *testing.T) {
+		octx := context.WithValue(context.Background(), "tenant", "b")
+		var n int64
+		p.UseDB(octx).Model(&TestBlindIndexModel{}).Scopes(WhereEncrypted("email", "c@example.com")).Count(&n)
+		if n != 0 {
+			t.Errorf("expect not found with other tenant key, got: %d", n)
+		}
+	})
+}
+
+func TestWhereEncrypted_Error(t *testing.T) {
+	p := testdb_newprovider_blind_index(t, "blind_index_error")
+	ctx := context.WithValue(context.Background(), "tenant", "a")
+
+	err := p.UseDB(ctx).Scopes(WhereEncrypted("id", "1")).First(&TestBlindIndexModel{}).Error
+	if !errors.Is(err, ErrBlindIndexNotConfigured) {
+		t.Errorf("expect: %v, got: %v", ErrBlindIndexNotConfigured, err)
+	}
+
+	np := testdb_newprovider(t, "blind_index_not_configured")
+	err = np.UseDB(ctx).Scopes(WhereEncrypted("name", "1")).First(&TestDBModel{}).Error
+	if !errors.Is(err, ErrBlindIndexNotConfigured) {
+		t.Errorf("expect: %v, got: %v", ErrBlindIndexNotConfigured, err)
+	}
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -158,3 +160,149 @@ func TestEncryptAndDecrypt(t *testing.T) {
 		t.Errorf("expect: %s, got: %s", raw, de)
 	}
 }
+
+func TestEncryptAndDecrypt_AESGCM(t *testing.T) {
+	aesKey := func(ctx context.Context) (string, error) {
+		return strings.Repeat("a", 32), nil
+	}
+	encrypt := EncryptTagHandler(aesKey)
+	decrypt := DecryptTagHandler(aesKey)
+
+	ctx := context.Background()
+	raw := "raw data"
+	en1, err := encrypt(ctx, "aes-gcm", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	en2, err := encrypt(ctx, "aes-gcm", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if en1 == en2 {
+		t.Errorf("expect random nonce, got same ciphertext: %s", en1)
+	}
+	for _, en := range []string{en1, en2} {
+		de, err := decrypt(ctx, "aes-gcm", en)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if de != raw {
+			t.Errorf("expect: %s, got: %s", raw, de)
+		}
+	}
+}
+
+func TestAESGCMDecrypt_Error(t *testing.T) {
+	key := []byte(strings.Repeat("k", 16))
+	envelope, err := AESGCMEncrypt([]byte("raw data"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(i int) []byte {
+		b := append([]byte(nil), envelope...)
+		b[i] ^= 0xff
+		return b
+	}
+
+	cases := []struct {
+		name   string
+		give   []byte
+		key    []byte
+		expect error
+	}{
+		{name: "tampered ciphertext", give: tamper(len(envelope) - 1), key: key, expect: ErrCiphertextAuthFailed},
+		{name: "tampered nonce", give: tamper(1), key: key, expect: ErrCiphertextAuthFailed},
+		{name: "unknown version", give: tamper(0), key: key, expect: ErrUnsupportedCiphertextVersion},
+		{name: "truncated", give: envelope[:10], key: key, expect: ErrInvalidCiphertext},
+		{name: "wrong key", give: envelope, key: []byte(strings.Repeat("x", 16)), expect: ErrCiphertextAuthFailed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := AESGCMDecrypt(c.give, c.key)
+			if !errors.Is(err, c.expect) {
+				t.Errorf("expect: %v, got: %v", c.expect, err)
+			}
+		})
+	}
+}
+
+func TestAESDecrypt_Malformed(t *testing.T) {
+	key := []byte(strings.Repeat("a", 16))
+	cases := []struct {
+		name string
+		give []byte
+	}{
+		{name: "empty", give: []byte{}},
+		{name: "not block size", give: []byte("short")},
+		{name: "invalid padding", give: bytes.Repeat([]byte{0}, 16)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := AESDecrypt(c.give, key); !errors.Is(err, ErrInvalidCiphertext) {
+				t.Errorf("expect: %v, got: %v", ErrInvalidCiphertext, err)
+			}
+		})
+	}
+}
+
+func TestAESEncrypt_KeySize(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		key := []byte(strings.Repeat("k", size))
+		en, err := AESEncrypt([]byte("raw data"), key)
+		if err != nil {
+			t.Fatalf("key size %d: %v", size, err)
+		}
+		de, err := AESDecrypt(en, key)
+		if err != nil || string(de) != "raw data" {
+			t.Errorf("key size %d, expect: raw data, got: %s, %v", size, de, err)
+		}
+	}
+	if _, err := AESEncrypt([]byte("raw data"), []byte("short")); err == nil {
+		t.Error("expect error of invalid key size")
+	}
+	if _, err := AESDecrypt(bytes.Repeat([]byte{0}, 16), []byte("short")); err == nil {
+		t.Error("expect error of invalid key size")
+	}
+}
+
+type TestGCMCryptoModel struct {
+	ID     int64
+	Legacy string `encrypt:"aes"`
+	Phone  string `encrypt:"aes-gcm"`
+}
+
+func TestCryptoHook_AESGCM(t *testing.T) {
+	aesKey := func(ctx context.Context) (string, error) {
+		return strings.Repeat("a", 16), nil
+	}
+	dial := WithInitializeHook(testdb_dial(t), CryptoHook(EncryptTagHandler(aesKey), DecryptTagHandler(aesKey)))
+	p := testdb_newprovider_with_dial(t, dial, "crypto_hook_gcm")
+	ctx := context.Background()
+
+	if err := p.UseDB(ctx).AutoMigrate(&TestGCMCryptoModel{}); err != nil {
+		t.Fatal(err)
+	}
+	m := &TestGCMCryptoModel{ID: 1, Legacy: "legacy", Phone: "13800000000"}
+	if err := p.UseDB(ctx).Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raw struct{ Legacy, Phone string }
+	p.UseDB(ctx).Table("test_gcm_crypto_models").Where("id = ?", 1).Scan(&raw)
+	if raw.Phone == "13800000000" || raw.Legacy == "legacy" {
+		t.Errorf("expect stored encrypted, got: %+v", raw)
+	}
+
+	got := &TestGCMCryptoModel{}
+	if err := p.UseDB(ctx).First(got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, &TestGCMCryptoModel{ID: 1, Legacy: "legacy", Phone: "13800000000"}) {
+		t.Errorf("unexpected decrypted model: %+v", got)
+	}
+
+	p.UseDB(ctx).Exec("UPDATE test_gcm_crypto_models SET phone = ? WHERE id = ?", "AQ"+strings.Repeat("A", 42), 1)
+	if err := p.UseDB(ctx).First(&TestGCMCryptoModel{}, 1).Error; !errors.Is(err, ErrCiphertextAuthFailed) {
+		t.Errorf("expect: %v, got: %v", ErrCiphertextAuthFailed, err)
+	}
+}
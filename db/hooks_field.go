@@ -0,0 +1,130 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+// 字段处理回调名称.
+const (
+	EncodeJSONFieldCallback = "glue:encode_json_field"
+	NormalizeFieldCallback  = "glue:normalize_field"
+	BlindIndexFieldCallback = "glue:blind_index"
+	CompressFieldCallback   = "glue:compress_field"
+	EncryptFieldCallback    = "glue:encrypt_field"
+
+	DecryptFieldCallback    = "glue:decrypt_field"
+	DecompressFieldCallback = "glue:decompress_field"
+	DecodeJSONFieldCallback = "glue:decode_json_field"
+	MaskFieldCallback       = "glue:mask_field"
+)
+
+// 写入前字段处理顺序: JSON 序列化 -> 规范化 -> 盲索引 -> 压缩 -> 加密.
+var writeFieldCallbacks = []string{
+	EncodeJSONFieldCallback,
+	NormalizeFieldCallback,
+	BlindIndexFieldCallback,
+	CompressFieldCallback,
+	EncryptFieldCallback,
+}
+
+// 读取后字段处理顺序: 解密 -> 解压 -> JSON 反序列化 -> 脱敏.
+var readFieldCallbacks = []string{
+	DecryptFieldCallback,
+	DecompressFieldCallback,
+	DecodeJSONFieldCallback,
+	MaskFieldCallback,
+}
+
+// nextFieldCallback 返回 name 之后已注册的字段处理回调.
+//
+// 回调按注册位置插入到后续回调之前, 保证不同 Hook 的注册顺序不影响执行顺序.
+func nextFieldCallback(order []string, name string, get func(string) func(*gorm.DB)) string {
+	found := false
+	for _, n := range order {
+		if found && get(n) != nil {
+			return n
+		}
+		if n == name {
+			found = true
+		}
+	}
+	return ""
+}
+
+// fieldCallbackProcessor 代表 gorm 回调处理器的注册方法.
+type fieldCallbackProcessor struct {
+	// 核心回调名称, 如: gorm:create.
+	main   string
+	get    func(name string) func(*gorm.DB)
+	before func(name string) func(string, func(*gorm.DB)) error
+	after  func(name string) func(string, func(*gorm.DB)) error
+}
+
+func createFieldCallbackProcessor(db *gorm.DB) fieldCallbackProcessor {
+	p := db.Callback().Create()
+	return fieldCallbackProcessor{
+		main:   "gorm:create",
+		get:    p.Get,
+		before: func(name string) func(string, func(*gorm.DB)) error { return p.Before(name).Register },
+		after:  func(name string) func(string, func(*gorm.DB)) error { return p.After(name).Register },
+	}
+}
+
+func updateFieldCallbackProcessor(db *gorm.DB) fieldCallbackProcessor {
+	p := db.Callback().Update()
+	return fieldCallbackProcessor{
+		main:   "gorm:update",
+		get:    p.Get,
+		before: func(name string) func(string, func(*gorm.DB)) error { return p.Before(name).Register },
+		after:  func(name string) func(string, func(*gorm.DB)) error { return p.After(name).Register },
+	}
+}
+
+func queryFieldCallbackProcessor(db *gorm.DB) fieldCallbackProcessor {
+	p := db.Callback().Query()
+	return fieldCallbackProcessor{
+		main:   "gorm:query",
+		get:    p.Get,
+		before: func(name string) func(string, func(*gorm.DB)) error { return p.Before(name).Register },
+		after:  func(name string) func(string, func(*gorm.DB)) error { return p.After(name).Register },
+	}
+}
+
+// registerWriteFieldCallback 注册写入前字段处理回调.
+//
+// 在 gorm:create, gorm:update 之前, 按 writeFieldCallbacks 顺序执行.
+func registerWriteFieldCallback(db *gorm.DB, name string, fn func(*gorm.DB)) error {
+	for _, p := range []fieldCallbackProcessor{createFieldCallbackProcessor(db), updateFieldCallbackProcessor(db)} {
+		before := nextFieldCallback(writeFieldCallbacks, name, p.get)
+		if before == "" {
+			before = p.main
+		}
+		if err := p.before(before)(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerReadFieldCallback 注册读取后字段处理回调.
+//
+// 在 gorm:query 之后, 按 readFieldCallbacks 顺序执行.
+// withWrite 为 true 时, 同时在 gorm:create, gorm:update 之后执行, 还原写入前的值.
+func registerReadFieldCallback(db *gorm.DB, name string, fn func(*gorm.DB), withWrite bool) error {
+	ps := []fieldCallbackProcessor{queryFieldCallbackProcessor(db)}
+	if withWrite {
+		ps = append(ps, createFieldCallbackProcessor(db), updateFieldCallbackProcessor(db))
+	}
+	for _, p := range ps {
+		var err error
+		if before := nextFieldCallback(readFieldCallbacks, name, p.get); before != "" {
+			err = p.before(before)(name, fn)
+		} else {
+			err = p.after(p.main)(name, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type TestFieldModel struct {
+	ID        int64
+	Email     string `normalize:"lower,trim" encrypt:"aes;index:email_bidx"`
+	EmailBidx string
+	Content   string  `compress:"gzip" encrypt:"aes"`
+	Phone     *string `encrypt:"aes" mask:"phone"`
+}
+
+func testdb_field_allowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value("allowed").(bool)
+	return allowed
+}
+
+func TestFieldHooks_Order(t *testing.T) {
+	keyf := func(context.Context) (string, error) { return "key", nil }
+	crypto := CryptoHook(testCryptoMarshal, testCryptoUnmarshal, WithBlindIndex(keyf))
+	orders := map[string][]func(*gorm.DB) error{
+		"crypto_first": {crypto, NormalizeHook(), CompressHook(), MaskHook(testdb_field_allowed)},
+		"crypto_last":  {MaskHook(testdb_field_allowed), CompressHook(), NormalizeHook(), crypto},
+	}
+	for name, hooks := range orders {
+		t.Run(name, func(t *testing.T) {
+			p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), hooks...), "field_"+name)
+			ctx := context.Background()
+			if err := p.UseDB(ctx).AutoMigrate(&TestFieldModel{}); err != nil {
+				t.Fatal(err)
+			}
+			phone := "13800001234"
+			m := &TestFieldModel{ID: 1, Email: " A@Example.com ", Content: "content", Phone: &phone}
+			if err := p.UseDB(ctx).Create(m).Error; err != nil {
+				t.Fatal(err)
+			}
+			if m.Email != "a@example.com" || m.Content != "content" || *m.Phone != phone {
+				t.Errorf("unexpected model after create: %+v", m)
+			}
+
+			var raw struct{ Email, EmailBidx, Content, Phone string }
+			p.UseDB(ctx).Table("test_field_models").Where("id = ?", 1).Scan(&raw)
+			if raw.Email != "a@example.com_encrypted" {
+				t.Errorf("expect normalized before encrypt, got: %s", raw.Email)
+			}
+			if raw.EmailBidx != BlindIndex("key", "a@example.com") {
+				t.Errorf("expect index of normalized value, got: %s", raw.EmailBidx)
+			}
+			compressed, _ := GzipCompress([]byte("content"))
+			if exp := base64.StdEncoding.EncodeToString(compressed) + "_encrypted"; raw.Content != exp {
+				t.Errorf("expect compressed before encrypt: %s, got: %s", exp, raw.Content)
+			}
+
+			got := &TestFieldModel{}
+			if err := p.UseDB(ctx).Scopes(WhereEncrypted("email", "A@example.COM")).First(got).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Content != "content" || *got.Phone != "138****1234" {
+				t.Errorf("expect decompressed and masked, got: %+v", got)
+			}
+
+			actx := context.WithValue(ctx, "allowed", true)
+			if err := p.UseDB(actx).First(got, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if *got.Phone != phone {
+				t.Errorf("expect not masked, got: %s", *got.Phone)
+			}
+		})
+	}
+}
+
+func TestNormalizeTagHandler(t *testing.T) {
+	cases := []struct {
+		tag, give, exp string
+	}{
+		{tag: "lower,trim", give: " A@B.com ", exp: "a@b.com"},
+		{tag: "upper", give: "abc", exp: "ABC"},
+		{tag: "space", give: "  a   b \t c ", exp: "a b c"},
+		{tag: "", give: " a ", exp: " a "},
+	}
+	for _, c := range cases {
+		got, err := NormalizeTagHandler(context.Background(), c.tag, c.give)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.exp {
+			t.Errorf("tag: %s, expect: %q, got: %q", c.tag, c.exp, got)
+		}
+	}
+	if _, err := NormalizeTagHandler(context.Background(), "lower,unknown", "a"); err == nil {
+		t.Error("expect error of unknown rule")
+	}
+}
+
+func TestMask(t *testing.T) {
+	cases := []struct {
+		rule, give, exp string
+	}{
+		{rule: "", give: "abcd", exp: "a**d"},
+		{rule: "all", give: "abc", exp: "***"},
+		{rule: "name", give: "张三丰", exp: "张**"},
+		{rule: "phone", give: "13800001234", exp: "138****1234"},
+		{rule: "phone", give: "1234", exp: "1***"},
+		{rule: "email", give: "alice@example.com", exp: "a****@example.com"},
+		{rule: "true", give: "a", exp: "*"},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s_%s", c.rule, c.give), func(t *testing.T) {
+			got, err := Mask(c.rule, c.give)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.exp {
+				t.Errorf("expect: %s, got: %s", c.exp, got)
+			}
+		})
+	}
+	if _, err := Mask("unknown", "a"); err == nil {
+		t.Error("expect error of unknown rule")
+	}
+}
+
+func TestCompressTagHandler(t *testing.T) {
+	ctx := context.Background()
+	raw := strings.Repeat("large text ", 100)
+	compressed, err := CompressTagHandler(ctx, "gzip", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(raw) {
+		t.Errorf("expect compressed, got length: %d", len(compressed))
+	}
+	got, err := DecompressTagHandler(ctx, "gzip", compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != raw {
+		t.Errorf("expect: %s, got: %s", raw, got)
+	}
+
+	for _, give := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("not gzip"))} {
+		if _, err := DecompressTagHandler(ctx, "gzip", give); !errors.Is(err, ErrInvalidCompressed) {
+			t.Errorf("expect: %v, got: %v", ErrInvalidCompressed, err)
+		}
+	}
+	if _, err := CompressTagHandler(ctx, "zstd", raw); err == nil {
+		t.Error("expect error of unsupported algorithm")
+	}
+}
+
+type TestJSONProfile struct {
+	Nickname string   `json:"nickname"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+type TestJSONModel struct {
+	ID          int64
+	Profile     TestJSONProfile  `gorm:"-" dbjson:"profile_json"`
+	ProfileJSON string           `compress:"gzip" encrypt:"aes"`
+	Extra       *TestJSONProfile `gorm:"-" dbjson:"extra_json"`
+	ExtraJSON   *string
+}
+
+func TestJSONHook(t *testing.T) {
+	crypto := CryptoHook(testCryptoMarshal, testCryptoUnmarshal)
+	dial := WithInitializeHook(testdb_dial(t), crypto, CompressHook(), JSONHook())
+	p := testdb_newprovider_with_dial(t, dial, "field_json")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestJSONModel{}); err != nil {
+		t.Fatal(err)
+	}
+	m := &TestJSONModel{ID: 1, Profile: TestJSONProfile{Nickname: "tom", Tags: []string{"a"}}}
+	if err := p.UseDB(ctx).Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raw struct {
+		ProfileJSON string
+		ExtraJSON   *string
+	}
+	p.UseDB(ctx).Table("test_json_models").Where("id = ?", 1).Scan(&raw)
+	compressed, _ := GzipCompress([]byte(`{"nickname":"tom","tags":["a"]}`))
+	if exp := base64.StdEncoding.EncodeToString(compressed) + "_encrypted"; raw.ProfileJSON != exp {
+		t.Errorf("expect json before compress and encrypt: %s, got: %s", exp, raw.ProfileJSON)
+	}
+	if raw.ExtraJSON != nil {
+		t.Errorf("expect nil pointer not written, got: %s", *raw.ExtraJSON)
+	}
+
+	m.Profile.Nickname = "jerry"
+	m.Extra = &TestJSONProfile{Nickname: "extra"}
+	if err := p.UseDB(ctx).Save(m).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := &TestJSONModel{}
+	if err := p.UseDB(ctx).First(got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Profile.Nickname != "jerry" || len(got.Profile.Tags) != 1 || got.Extra == nil || got.Extra.Nickname != "extra" {
+		t.Errorf("unexpected model: %+v, extra: %+v", got, got.Extra)
+	}
+
+	type TestJSONBadModel struct {
+		ID      int64
+		Profile TestJSONProfile `gorm:"-" dbjson:"not_exists"`
+	}
+	if err := p.UseDB(ctx).Table("test_json_models").Create(&TestJSONBadModel{ID: 2}).Error; err == nil || !strings.Contains(err.Error(), "not_exists") {
+		t.Errorf("expect shadow field not found, got: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// JSONTagName JSON 字段 tag 名称.
+//
+// 不使用 json, 避免与 encoding/json tag 冲突.
+var JSONTagName = "dbjson"
+
+// JSONHook 实现结构体字段以 JSON 保存.
+//
+// 对 dbjson:"settings_json" 标记的字段, 写入前序列化为 JSON 写入影子字段 settings_json,
+// 读取后从影子字段反序列化. 字段需标记 gorm:"-", 影子字段类型: string, *string, []byte.
+//
+// 与 gorm:"serializer:json" 不同, 影子字段可以继续规范化, 压缩和加密:
+// 写入时最先序列化, 读取时在解密, 解压后, 脱敏前反序列化.
+// 空指针, 空 map 和空切片不写入影子字段, 影子字段为空时不做反序列化.
+//
+// 例:
+//	type User struct {
+//		Profile     Profile `gorm:"-" dbjson:"profile_json"`
+//		ProfileJSON string  `compress:"gzip" encrypt:"aes"`
+//	}
+//	dial := WithInitializeHook(xxx.Dialector, JSONHook(), CompressHook(), cryptoHook)
+func JSONHook() func(*gorm.DB) error {
+	return func(db *gorm.DB) error {
+		if err := registerWriteFieldCallback(db, EncodeJSONFieldCallback, encodeJSONFields); err != nil {
+			return err
+		}
+		return registerReadFieldCallback(db, DecodeJSONFieldCallback, decodeJSONFields, true)
+	}
+}
+
+type jsonField struct {
+	field, shadow *schema.Field
+}
+
+// lookupJSONFields 返回模型中的 JSON 字段及其影子字段.
+func lookupJSONFields(sch *schema.Schema) ([]jsonField, error) {
+	var fields []jsonField
+	for _, field := range sch.Fields {
+		name, ok := field.Tag.Lookup(JSONTagName)
+		if !ok {
+			continue
+		}
+		shadow := sch.LookUpField(name)
+		if shadow == nil {
+			return nil, fmt.Errorf("json shadow field %s not found in %s", name, sch.Name)
+		}
+		fields = append(fields, jsonField{field: field, shadow: shadow})
+	}
+	return fields, nil
+}
+
+// encodeJSONFields 序列化 JSON 字段并写入影子字段.
+func encodeJSONFields(db *gorm.DB) {
+	walkJSONFields(db, func(r record, f jsonField) error {
+		value, _, ok := r.get(f.field)
+		if !ok || value == nil {
+			return nil
+		}
+		if rv := reflect.ValueOf(value); (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.IsNil() {
+			return nil
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("marshal json field %s: %w", f.field.Name, err)
+		}
+		return r.set(f.shadow, string(b))
+	})
+}
+
+// decodeJSONFields 从影子字段反序列化 JSON 字段.
+func decodeJSONFields(db *gorm.DB) {
+	walkJSONFields(db, func(r record, f jsonField) error {
+		// 查询结果为 map 时没有对应的结构体字段.
+		if _, ok := r.(*mapRecord); ok {
+			return nil
+		}
+		value, _, ok := r.get(f.shadow)
+		if !ok {
+			return nil
+		}
+		var b []byte
+		switch v := value.(type) {
+		case string:
+			b = []byte(v)
+		case *string:
+			if v != nil {
+				b = []byte(*v)
+			}
+		case []byte:
+			b = v
+		default:
+			if value != nil {
+				return fmt.Errorf("non-stringable type: %T", value)
+			}
+		}
+		if len(b) == 0 {
+			return nil
+		}
+		v := reflect.New(f.field.FieldType)
+		if err := json.Unmarshal(b, v.Interface()); err != nil {
+			return fmt.Errorf("unmarshal json field %s: %w", f.field.Name, err)
+		}
+		return r.set(f.field, v.Elem().Interface())
+	})
+}
+
+func walkJSONFields(db *gorm.DB, fn func(record, jsonField) error) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	fields, err := lookupJSONFields(db.Statement.Schema)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	if len(fields) == 0 {
+		return
+	}
+	err = walkRecords(db, func(r record) error {
+		for _, f := range fields {
+			if err := fn(r, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.AddError(err)
+	}
+}
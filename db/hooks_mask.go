@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	MaskTagName = "mask"
+
+	// MaskChar 脱敏替换字符.
+	MaskChar = '*'
+)
+
+// MaskHook 实现查询结果字段脱敏.
+//
+// 支持的字段类型：string, *string, []byte
+//
+// allowed 返回 false 时, 查询结果中标记 mask tag 的字段被脱敏.
+// 在解密, 解压后执行. 只处理查询, 不影响写入.
+//
+// ⚠️ 注意: 脱敏后的记录不应再保存, 否则脱敏值会覆盖原值.
+//
+// 例:
+//	type User struct {
+//		Phone string `encrypt:"aes" mask:"phone"`
+//	}
+//	dial := WithInitializeHook(xxx.Dialector, cryptoHook, MaskHook(auth.CanViewPII))
+func MaskHook(allowed func(ctx context.Context) bool) func(*gorm.DB) error {
+	p := NewTagProcessor(MaskTagName, nil, WrapStringTagHandler(NonEmptyStringTagHandler(MaskTagHandler(allowed))))
+	return func(db *gorm.DB) error {
+		return registerReadFieldCallback(db, MaskFieldCallback, p.Unmarshal, false)
+	}
+}
+
+// MaskTagHandler 处理字段脱敏, allowed 返回 true 时不做处理.
+func MaskTagHandler(allowed func(ctx context.Context) bool) StringTagHandler {
+	return func(ctx context.Context, tagValue string, fieldValue string) (string, error) {
+		if allowed != nil && allowed(ctx) {
+			return fieldValue, nil
+		}
+		return Mask(tagValue, fieldValue)
+	}
+}
+
+// Mask 按规则脱敏.
+//
+// 规则     | 说明
+// ""      | 保留首尾各一个字符
+// "true"  | 保留首尾各一个字符
+// "all"   | 全部替换
+// "name"  | 保留首个字符
+// "phone" | 保留前 3 位和后 4 位
+// "email" | 保留用户名首个字符和域名
+func Mask(rule, value string) (string, error) {
+	switch rule {
+	case "", "true":
+		return maskRunes(value, 1, 1), nil
+	case "all":
+		return maskRunes(value, 0, 0), nil
+	case "name":
+		return maskRunes(value, 1, 0), nil
+	case "phone":
+		return maskRunes(value, 3, 4), nil
+	case "email":
+		at := strings.LastIndex(value, "@")
+		if at < 0 {
+			return maskRunes(value, 1, 1), nil
+		}
+		return maskRunes(value[:at], 1, 0) + value[at:], nil
+	default:
+		return "", fmt.Errorf("mask rule: %s not support", rule)
+	}
+}
+
+// maskRunes 保留前 first 个和后 last 个字符, 其余替换为 MaskChar.
+//
+// 字符数不足时只保留首个字符, 单个字符全部替换.
+func maskRunes(value string, first, last int) string {
+	rs := []rune(value)
+	if len(rs) <= first+last {
+		first, last = 1, 0
+		if len(rs) <= 1 {
+			first = 0
+		}
+	}
+	for i := first; i < len(rs)-last; i++ {
+		rs[i] = MaskChar
+	}
+	return string(rs)
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var NormalizeTagName = "normalize"
+
+// NormalizeHook 实现字段写入前规范化.
+//
+// 支持的字段类型：string, *string, []byte
+//
+// 在盲索引, 压缩和加密前执行, 盲索引基于规范化后的值计算.
+// WhereEncrypted 检索时对检索值做同样的规范化.
+//
+// 例:
+//	type User struct {
+//		Email string `normalize:"lower,trim" encrypt:"aes;index:email_bidx"`
+//	}
+//	dial := WithInitializeHook(xxx.Dialector, NormalizeHook(), cryptoHook)
+func NormalizeHook() func(*gorm.DB) error {
+	p := NewTagProcessor(NormalizeTagName, WrapStringTagHandler(NormalizeTagHandler), nil)
+	return func(db *gorm.DB) error {
+		return registerWriteFieldCallback(db, NormalizeFieldCallback, p.Marshal)
+	}
+}
+
+// NormalizeTagHandler 处理字段规范化.
+//
+// tag 值为逗号分隔的规则, 按顺序执行.
+//
+// 规则   | 说明
+// lower | 转换为小写
+// upper | 转换为大写
+// trim  | 去除首尾空白
+// space | 合并连续空白为一个空格, 并去除首尾空白
+func NormalizeTagHandler(ctx context.Context, tagValue string, fieldValue string) (string, error) {
+	for _, rule := range strings.Split(tagValue, ",") {
+		switch strings.TrimSpace(rule) {
+		case "":
+		case "lower":
+			fieldValue = strings.ToLower(fieldValue)
+		case "upper":
+			fieldValue = strings.ToUpper(fieldValue)
+		case "trim":
+			fieldValue = strings.TrimSpace(fieldValue)
+		case "space":
+			fieldValue = strings.Join(strings.Fields(fieldValue), " ")
+		default:
+			return "", fmt.Errorf("normalize rule: %s not support", rule)
+		}
+	}
+	return fieldValue, nil
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// record 代表语句中的一条记录, 记录可以是结构体或 map.
+//
+// 字段通过语句模型 Schema 中的字段访问.
+type record interface {
+	// get 获取字段值, 记录不包含该字段时 ok 为 false.
+	get(field *schema.Field) (value interface{}, isZero bool, ok bool)
+	// set 设置字段值.
+	set(field *schema.Field, value interface{}) error
+}
+
+// recordSchemas 缓存 Dest 与 Model 类型不同时 Dest 的 Schema.
+var recordSchemas = &sync.Map{}
+
+// walkRecords 遍历语句中的记录.
+//
+// 支持的语句形态:
+//   1. Statement.ReflectValue 为结构体, 结构体(指针)切片/数组, map, map 切片.
+//   2. Statement.Dest 与 Model 不同, 如:
+//      Model(&u).Updates(map[string]interface{}{...})
+//      Model(&u).Updates(User{...})
+//      Model(&u).UpdateColumn("phone", v)
+//   3. 嵌入结构体字段由 Schema 展开处理, 关联记录由 gorm 以独立语句保存和查询.
+//
+// Dest 为不可寻址的结构体时, 替换为结构体指针副本, 不修改调用方数据.
+func walkRecords(db *gorm.DB, fn func(record) error) error {
+	stmt := db.Statement
+	sch := stmt.Schema
+	rv := stmt.ReflectValue
+	if err := walkValue(db, sch, rv, fn); err != nil {
+		return err
+	}
+	if stmt.Dest == nil || stmt.Model == nil {
+		return nil
+	}
+
+	dv := reflect.ValueOf(stmt.Dest)
+	if dv.Kind() == reflect.Struct {
+		cp := reflect.New(dv.Type())
+		cp.Elem().Set(dv)
+		stmt.Dest = cp.Interface()
+		dv = cp
+	}
+	for dv.Kind() == reflect.Ptr && !dv.IsNil() {
+		dv = dv.Elem()
+	}
+	if sameValue(rv, dv) {
+		return nil
+	}
+	return walkValue(db, sch, dv, fn)
+}
+
+func walkValue(db *gorm.DB, sch *schema.Schema, rv reflect.Value, fn func(record) error) error {
+	ctx := db.Statement.Context
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := walkValue(db, sch, rv.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return walkValue(db, sch, rv.Elem(), fn)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		return fn(&mapRecord{rv: rv})
+	case reflect.Struct:
+		if rv.Type() == sch.ModelType {
+			return fn(&structRecord{ctx: ctx, rv: rv})
+		}
+		if !rv.CanAddr() {
+			return nil
+		}
+		ds, err := schema.Parse(rv.Addr().Interface(), recordSchemas, db.NamingStrategy)
+		if errors.Is(err, schema.ErrUnsupportedDataType) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(&structRecord{ctx: ctx, rv: rv, schema: ds})
+	}
+	return nil
+}
+
+// sameValue 判断两个值是否指向同一数据.
+func sameValue(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Map:
+		return a.Pointer() == b.Pointer()
+	case reflect.Slice:
+		return a.Pointer() == b.Pointer() && a.Len() == b.Len()
+	}
+	if a.CanAddr() && b.CanAddr() {
+		return a.UnsafeAddr() == b.UnsafeAddr()
+	}
+	return false
+}
+
+// structRecord 代表结构体记录.
+type structRecord struct {
+	ctx context.Context
+	rv  reflect.Value
+	// 结构体类型与语句模型不同时, 结构体的 Schema.
+	//
+	// 按字段名匹配模型字段.
+	schema *schema.Schema
+}
+
+func (r *structRecord) lookup(field *schema.Field) *schema.Field {
+	if r.schema == nil {
+		return field
+	}
+	if f := r.schema.LookUpField(field.DBName); f != nil {
+		return f
+	}
+	return r.schema.LookUpField(field.Name)
+}
+
+func (r *structRecord) get(field *schema.Field) (interface{}, bool, bool) {
+	f := r.lookup(field)
+	if f == nil {
+		return nil, true, false
+	}
+	value, isZero := f.ValueOf(r.ctx, r.rv)
+	return value, isZero, true
+}
+
+func (r *structRecord) set(field *schema.Field, value interface{}) error {
+	f := r.lookup(field)
+	if f == nil {
+		return fmt.Errorf("field %s not found in %s", field.Name, r.rv.Type())
+	}
+	if !r.rv.CanAddr() {
+		return fmt.Errorf("unaddressable value of %s", r.rv.Type())
+	}
+	return f.Set(r.ctx, r.rv, value)
+}
+
+// mapRecord 代表 map 记录, key 为字段名或列名.
+type mapRecord struct {
+	rv reflect.Value
+}
+
+func (r *mapRecord) key(field *schema.Field) (reflect.Value, bool) {
+	for _, name := range []string{field.DBName, field.Name} {
+		if name == "" {
+			continue
+		}
+		key := reflect.ValueOf(name).Convert(r.rv.Type().Key())
+		if r.rv.MapIndex(key).IsValid() {
+			return key, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func (r *mapRecord) get(field *schema.Field) (interface{}, bool, bool) {
+	key, ok := r.key(field)
+	if !ok {
+		return nil, true, false
+	}
+	value := r.rv.MapIndex(key).Interface()
+	// 表达式不做处理, 如: gorm.Expr("NULL").
+	if _, ok := value.(clause.Expression); ok {
+		return nil, true, false
+	}
+	if value == nil {
+		return nil, true, true
+	}
+	return value, reflect.ValueOf(value).IsZero(), true
+}
+
+func (r *mapRecord) set(field *schema.Field, value interface{}) error {
+	key, ok := r.key(field)
+	if !ok {
+		key = reflect.ValueOf(field.DBName).Convert(r.rv.Type().Key())
+	}
+	v := reflect.ValueOf(value)
+	elem := r.rv.Type().Elem()
+	if !v.IsValid() {
+		v = reflect.Zero(elem)
+	}
+	if !v.Type().AssignableTo(elem) {
+		if !v.Type().ConvertibleTo(elem) {
+			return fmt.Errorf("cannot set %T to map of %s", value, elem)
+		}
+		v = v.Convert(elem)
+	}
+	r.rv.SetMapIndex(key, v)
+	return nil
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+type TestRecordProfile struct {
+	ID           int64
+	TestRecordID int64
+	IDCard       string `encrypt:"aes"`
+}
+
+type TestRecordAudit struct {
+	Remark string `encrypt:"aes"`
+}
+
+type TestRecordModel struct {
+	ID      int64
+	Name    string
+	Phone   string             `encrypt:"aes"`
+	Profile *TestRecordProfile `gorm:"foreignKey:TestRecordID"`
+	TestRecordAudit
+}
+
+type TestRecordPhone struct {
+	Name  string
+	Phone string
+}
+
+func testdb_newprovider_record(t *testing.T, name string) *TransProvider {
+	dial := WithInitializeHook(testdb_dial(t), CryptoHook(testCryptoMarshal, testCryptoUnmarshal))
+	p := testdb_newprovider_with_dial(t, dial, name)
+	if err := p.UseDB(context.Background()).AutoMigrate(&TestRecordModel{}, &TestRecordProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func testdb_raw_phone(t *testing.T, p *TransProvider, id int64) string {
+	var phone string
+	p.UseDB(context.Background()).Table("test_record_models").Where("id = ?", id).Pluck("phone", &phone)
+	return phone
+}
+
+func TestTagProcessor_Update(t *testing.T) {
+	p := testdb_newprovider_record(t, "record_update")
+	ctx := context.Background()
+
+	m := &TestRecordModel{ID: 1, Name: "name", Phone: "p0"}
+	if err := p.UseDB(ctx).Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		update func() error
+		exp    string
+	}{
+		{
+			name: "map",
+			update: func() error {
+				values := map[string]interface{}{"phone": "p1"}
+				if err := p.UseDB(ctx).Model(m).Updates(values).Error; err != nil {
+					return err
+				}
+				if values["phone"] != "p1" {
+					t.Errorf("expect map decrypted after update, got: %v", values["phone"])
+				}
+				return nil
+			},
+			exp: "p1_encrypted",
+		},
+		{
+			name: "map field name",
+			update: func() error {
+				return p.UseDB(ctx).Model(m).Updates(map[string]interface{}{"Phone": "p2"}).Error
+			},
+			exp: "p2_encrypted",
+		},
+		{
+			name: "update column",
+			update: func() error {
+				return p.UseDB(ctx).Model(m).UpdateColumn("phone", "p3").Error
+			},
+			exp: "p3_encrypted",
+		},
+		{
+			name: "update",
+			update: func() error {
+				return p.UseDB(ctx).Model(m).Update("phone", "p4").Error
+			},
+			exp: "p4_encrypted",
+		},
+		{
+			name: "struct value",
+			update: func() error {
+				return p.UseDB(ctx).Model(m).Updates(TestRecordModel{Phone: "p5"}).Error
+			},
+			exp: "p5_encrypted",
+		},
+		{
+			name: "other struct",
+			update: func() error {
+				return p.UseDB(ctx).Model(m).Updates(&TestRecordPhone{Name: "name", Phone: "p6"}).Error
+			},
+			exp: "p6_encrypted",
+		},
+		{
+			name: "select save",
+			update: func() error {
+				m.Phone = "p7"
+				return p.UseDB(ctx).Select("phone").Save(m).Error
+			},
+			exp: "p7_encrypted",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.update(); err != nil {
+				t.Fatal(err)
+			}
+			if got := testdb_raw_phone(t, p, 1); got != c.exp {
+				t.Errorf("expect stored: %s, got: %s", c.exp, got)
+			}
+		})
+	}
+}
+
+func TestTagProcessor_Shapes(t *testing.T) {
+	p := testdb_newprovider_record(t, "record_shapes")
+	ctx := context.Background()
+
+	ms := []*TestRecordModel{
+		{
+			ID:              1,
+			Phone:           "p1",
+			Profile:         &TestRecordProfile{ID: 1, IDCard: "c1"},
+			TestRecordAudit: TestRecordAudit{Remark: "r1"},
+		},
+		{ID: 2, Phone: "p2"},
+	}
+	if err := p.UseDB(ctx).Create(ms[:1]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UseDB(ctx).Create(ms[1:]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var raw struct{ Phone, Remark string }
+	p.UseDB(ctx).Table("test_record_models").Where("id = ?", 1).Scan(&raw)
+	if raw.Phone != "p1_encrypted" || raw.Remark != "r1_encrypted" {
+		t.Errorf("unexpected stored: %+v", raw)
+	}
+	var card string
+	p.UseDB(ctx).Table("test_record_profiles").Where("id = ?", 1).Pluck("id_card", &card)
+	if card != "c1_encrypted" {
+		t.Errorf("unexpected stored id card: %s", card)
+	}
+
+	t.Run("pointer slice", func(t *testing.T) {
+		var got []*TestRecordModel
+		if err := p.UseDB(ctx).Preload("Profile").Order("id").Find(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].Phone != "p1" || got[0].Remark != "r1" || got[0].Profile.IDCard != "c1" || got[1].Phone != "p2" {
+			t.Errorf("unexpected models: %+v", got)
+		}
+	})
+
+	t.Run("maps", func(t *testing.T) {
+		var got []map[string]interface{}
+		if err := p.UseDB(ctx).Model(&TestRecordModel{}).Order("id").Find(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0]["phone"] != "p1" || got[0]["remark"] != "r1" {
+			t.Errorf("unexpected maps: %+v", got)
+		}
+	})
+
+	t.Run("other struct", func(t *testing.T) {
+		var got []TestRecordPhone
+		if err := p.UseDB(ctx).Model(&TestRecordModel{}).Order("id").Find(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].Phone != "p1" || got[1].Phone != "p2" {
+			t.Errorf("unexpected results: %+v", got)
+		}
+	})
+
+	t.Run("create map", func(t *testing.T) {
+		values := map[string]interface{}{"id": 3, "phone": "p3"}
+		if err := p.UseDB(ctx).Model(&TestRecordModel{}).Create(values).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got := testdb_raw_phone(t, p, 3); got != "p3_encrypted" {
+			t.Errorf("unexpected stored: %s", got)
+		}
+	})
+}
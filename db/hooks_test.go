@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"testing"
@@ -81,6 +83,44 @@ func TestWithInitializeHook_Hooked(t *testing.T) {
 	d.AutoMigrate(&TestHookModel{})
 }
 
+func TestWithInitializeHook_NestedTransaction(t *testing.T) {
+	dial := WithInitializeHook(testdb_dial(t), func(*gorm.DB) error { return nil })
+	p := testdb_newprovider_with_dial(t, dial, "hook_nested")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestHookModel{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.Transaction(ctx, func(ctx context.Context) error {
+		if err := p.UseDB(ctx).Create(&TestHookModel{ID: 1}).Error; err != nil {
+			return err
+		}
+		// 内层事务回滚到 SavePoint, 不影响外层事务.
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			if err := p.UseDB(ctx).Create(&TestHookModel{ID: 2}).Error; err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		if err == nil || err.Error() != "rollback" {
+			t.Errorf("expect inner rollback error, got: %v", err)
+		}
+		return p.Transaction(ctx, func(ctx context.Context) error {
+			return p.UseDB(ctx).Create(&TestHookModel{ID: 3}).Error
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	if err := p.UseDB(ctx).Model(&TestHookModel{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[1 3]" {
+		t.Errorf("expect: [1 3], got: %v", ids)
+	}
+}
+
 func TestConnPoolHook(t *testing.T) {
 	cases := []struct {
 		opts *Options
@@ -120,3 +160,58 @@ func TestConnPoolHook_Error(t *testing.T) {
 		t.Error("expect not error")
 	}
 }
+
+func TestConnPoolHookWithIdleTime(t *testing.T) {
+	open := func(t *testing.T, name string, connMaxLifeTime, connMaxIdleTime time.Duration) *sql.DB {
+		d, err := (&Options{DBName: name}).OpenDB(testdb_dial(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hook := ConnPoolHookWithIdleTime(10, 20, connMaxLifeTime, connMaxIdleTime)
+		if err := hook(d); err != nil {
+			t.Fatal(err)
+		}
+		sd, err := d.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sd.Ping(); err != nil {
+			t.Fatal(err)
+		}
+		return sd
+	}
+
+	t.Run("max open connections", func(t *testing.T) {
+		sd := open(t, "conn_pool_open", 100*time.Second, 10*time.Second)
+		if n := sd.Stats().MaxOpenConnections; n != 20 {
+			t.Errorf("expect max open connections: %d, got: %d", 20, n)
+		}
+	})
+
+	t.Run("conn max lifetime", func(t *testing.T) {
+		sd := open(t, "conn_pool_lifetime", 10*time.Millisecond, time.Hour)
+		time.Sleep(20 * time.Millisecond)
+		// 复用连接时关闭超过生命周期的连接.
+		if err := sd.Ping(); err != nil {
+			t.Fatal(err)
+		}
+		if n := sd.Stats().MaxLifetimeClosed; n == 0 {
+			t.Errorf("expect connection closed by max lifetime")
+		}
+	})
+
+	t.Run("conn max idle time", func(t *testing.T) {
+		sd := open(t, "conn_pool_idle_time", time.Hour, 10*time.Millisecond)
+		// 连接清理间隔最小为 1s.
+		deadline := time.Now().Add(3 * time.Second)
+		for sd.Stats().MaxIdleTimeClosed == 0 && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if n := sd.Stats().MaxIdleTimeClosed; n == 0 {
+			t.Errorf("expect connection closed by max idle time")
+		}
+		if n := sd.Stats().MaxLifetimeClosed; n != 0 {
+			t.Errorf("expect no connection closed by max lifetime, got: %d", n)
+		}
+	})
+}
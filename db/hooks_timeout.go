@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrStatementTimeout = errors.New("default statement timeout exceeded")
+)
+
+const timeoutStateKey = "glue:timeout_state"
+
+// StatementTimeoutOptions 定义各类语句的默认超时配置.
+//
+// 值为 0 时该类语句不设置默认超时.
+type StatementTimeoutOptions struct {
+	QueryInMills  uint `yaml:"query"`
+	CreateInMills uint `yaml:"create"`
+	UpdateInMills uint `yaml:"update"`
+	DeleteInMills uint `yaml:"delete"`
+	RawInMills    uint `yaml:"raw"`
+}
+
+// StatementTimeoutError 代表默认超时触发导致的语句执行失败.
+//
+// errors.Is(err, ErrStatementTimeout) 返回 true.
+type StatementTimeoutError struct {
+	// 语句类型: query, create, update, delete, raw.
+	Operation string
+	// 触发的默认超时时间.
+	Timeout time.Duration
+	// 原始错误.
+	Err error
+}
+
+func (e *StatementTimeoutError) Error() string {
+	return fmt.Sprintf("%s statement exceeded default timeout %s: %v", e.Operation, e.Timeout, e.Err)
+}
+
+// Is 实现 errors.Is 判断.
+func (e *StatementTimeoutError) Is(target error) bool {
+	return target == ErrStatementTimeout
+}
+
+// Unwrap 返回原始错误.
+func (e *StatementTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+type statementTimeoutKey struct{}
+
+// WithStatementTimeout 覆盖 context 中执行语句的默认超时.
+//
+// 对所有类型语句生效, timeout 小于等于 0 时不设置默认超时.
+//
+// ctx 已设置 deadline 时, 默认超时不生效.
+func WithStatementTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, statementTimeoutKey{}, timeout)
+}
+
+// StatementTimeoutHook 实现数据库初始化时, 注入语句默认超时.
+//
+// 执行语句的 context 未设置 deadline 时, 按语句类型创建带默认超时的子 context.
+// 默认超时触发时, 返回 *StatementTimeoutError.
+//
+// 说明:
+//   Row/Rows/Scan 返回的结果集在回调结束后读取, 不设置默认超时.
+//
+// 例:
+//	dial := WithInitializeHook(xxx.Dialector, StatementTimeoutHook(&StatementTimeoutOptions{
+//		QueryInMills:  2000,
+//		CreateInMills: 1000,
+//	}))
+func StatementTimeoutHook(opts *StatementTimeoutOptions) func(*gorm.DB) error {
+	if opts == nil {
+		opts = &StatementTimeoutOptions{}
+	}
+	return func(db *gorm.DB) error {
+		cb := db.Callback()
+		processors := []struct {
+			operation string
+			timeout   uint
+			before    func(string, func(*gorm.DB)) error
+			after     func(string, func(*gorm.DB)) error
+		}{
+			{"query", opts.QueryInMills, cb.Query().Before("*").Register, cb.Query().After("*").Register},
+			{"create", opts.CreateInMills, cb.Create().Before("*").Register, cb.Create().After("*").Register},
+			{"update", opts.UpdateInMills, cb.Update().Before("*").Register, cb.Update().After("*").Register},
+			{"delete", opts.DeleteInMills, cb.Delete().Before("*").Register, cb.Delete().After("*").Register},
+			{"raw", opts.RawInMills, cb.Raw().Before("*").Register, cb.Raw().After("*").Register},
+		}
+		for _, p := range processors {
+			t := &statementTimeout{
+				operation: p.operation,
+				timeout:   time.Duration(p.timeout) * time.Millisecond,
+			}
+			if err := p.before("glue:timeout_before", t.before); err != nil {
+				return err
+			}
+			if err := p.after("glue:timeout_after", t.after); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type statementTimeout struct {
+	operation string
+	timeout   time.Duration
+}
+
+// getTimeout 返回语句的默认超时, 0 代表不设置.
+func (t *statementTimeout) getTimeout(ctx context.Context) time.Duration {
+	if ctx == nil {
+		return 0
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return 0
+	}
+	if d, ok := ctx.Value(statementTimeoutKey{}).(time.Duration); ok {
+		return d
+	}
+	return t.timeout
+}
+
+// timeoutState 记录语句执行前的 context.
+type timeoutState struct {
+	ctx     context.Context
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func (t *statementTimeout) before(db *gorm.DB) {
+	ctx := db.Statement.Context
+	timeout := t.getTimeout(ctx)
+	if timeout <= 0 {
+		// 复用 Statement 时清理上次执行的状态.
+		db.InstanceSet(timeoutStateKey, (*timeoutState)(nil))
+		return
+	}
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	db.InstanceSet(timeoutStateKey, &timeoutState{ctx: ctx, timeout: timeout, cancel: cancel})
+	db.Statement.Context = tctx
+}
+
+func (t *statementTimeout) after(db *gorm.DB) {
+	v, _ := db.InstanceGet(timeoutStateKey)
+	state, _ := v.(*timeoutState)
+	if state == nil {
+		return
+	}
+	defer state.cancel()
+
+	tctx := db.Statement.Context
+	// 恢复原始 context, 防止复用 Statement 时使用已取消的 context.
+	db.Statement.Context = state.ctx
+
+	if db.Error == nil || tctx.Err() != context.DeadlineExceeded {
+		return
+	}
+	db.Error = &StatementTimeoutError{
+		Operation: t.operation,
+		Timeout:   state.timeout,
+		Err:       db.Error,
+	}
+}
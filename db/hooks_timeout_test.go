@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 耗时查询.
+const testSlowSQL = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c LIMIT 100000000) SELECT count(*) FROM c"
+
+func TestStatementTimeoutHook(t *testing.T) {
+	dial := WithInitializeHook(testdb_dial(t), StatementTimeoutHook(&StatementTimeoutOptions{
+		QueryInMills: 10,
+	}))
+	p := testdb_newprovider_with_dial(t, dial, "statement_timeout")
+
+	t.Run("default timeout", func(t *testing.T) {
+		var n int64
+		err := p.UseDB(context.Background()).Raw(testSlowSQL).Find(&n).Error
+		if !errors.Is(err, ErrStatementTimeout) {
+			t.Fatalf("expect: %v, got: %v", ErrStatementTimeout, err)
+		}
+		var terr *StatementTimeoutError
+		if !errors.As(err, &terr) {
+			t.Fatalf("expect *StatementTimeoutError, got: %T", err)
+		}
+		if terr.Operation != "query" || terr.Timeout != 10*time.Millisecond {
+			t.Errorf("expect query timeout 10ms, got: %s %s", terr.Operation, terr.Timeout)
+		}
+	})
+
+	t.Run("caller deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		var n int64
+		err := p.UseDB(ctx).Raw(testSlowSQL).Find(&n).Error
+		if err == nil {
+			t.Fatal("expect error")
+		}
+		if errors.Is(err, ErrStatementTimeout) {
+			t.Errorf("expect caller deadline error, got: %v", err)
+		}
+	})
+
+	t.Run("override", func(t *testing.T) {
+		ctx := WithStatementTimeout(context.Background(), time.Minute)
+		var n int64
+		err := p.UseDB(ctx).Raw("SELECT 1").Find(&n).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx = WithStatementTimeout(context.Background(), 0)
+		if err := p.UseDB(ctx).Create(&TestDBModel{ID: 1}).Error; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("reuse statement", func(t *testing.T) {
+		db := p.UseDB(context.Background()).Where("id = ?", testDefaultRecord.ID)
+		for i := 0; i < 2; i++ {
+			m := &TestDBModel{}
+			if err := db.Find(m).Error; err != nil {
+				t.Fatal(err)
+			}
+			if m.Name != testDefaultRecord.Name {
+				t.Errorf("expect: %s, got: %s", testDefaultRecord.Name, m.Name)
+			}
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// DefaultSlowThreshold 默认慢 SQL 阈值.
+	DefaultSlowThreshold = 200 * time.Millisecond
+
+	// RedactedValue 日志中加密字段值的替换值.
+	RedactedValue = "***"
+)
+
+const (
+	traceStartKey = "glue:trace_start"
+	traceSpanKey  = "glue:trace_span"
+)
+
+// SQLTracer 定义 SQL 语句追踪.
+type SQLTracer interface {
+	// StartSpan 开始追踪 SQL 语句.
+	//
+	// operation 为语句类型, 如: create, query, update, delete, row, raw.
+	StartSpan(ctx context.Context, operation string) SQLSpan
+}
+
+// SQLSpan 代表一次 SQL 语句追踪.
+type SQLSpan interface {
+	// Finish 结束追踪.
+	//
+	// statement 为已脱敏的 SQL 语句.
+	Finish(statement string, rowsAffected int64, err error)
+}
+
+// SQLTraceHook 实现数据库初始化时, 注入 SQL 语句耗时统计与追踪.
+//
+// 1. 执行时间超过 slowThreshold 的语句以 Warn 级别记录, slowThreshold 小于等于 0
+//    时使用 DefaultSlowThreshold.
+// 2. 执行出错的语句以 Error 级别记录, gorm.ErrRecordNotFound 除外.
+// 3. 日志通过 logrus.WithContext 记录, log/hooks/context 注入的字段同样生效.
+// 4. 标记 encrypt tag 字段的值在日志和追踪中替换为 RedactedValue.
+// 5. tracer 不为 nil 时, 为每条语句创建追踪.
+//
+// 例:
+//	dial := WithInitializeHook(mysql.Dialector,
+//		CryptoHook(encrypt, decrypt),
+//		SQLTraceHook(500*time.Millisecond, nil))
+func SQLTraceHook(slowThreshold time.Duration, tracer SQLTracer) func(*gorm.DB) error {
+	if slowThreshold <= 0 {
+		slowThreshold = DefaultSlowThreshold
+	}
+	t := &sqlTrace{slowThreshold: slowThreshold, tracer: tracer}
+	return func(db *gorm.DB) error {
+		cb := db.Callback()
+		processors := []struct {
+			operation string
+			before    func(string, func(*gorm.DB)) error
+			after     func(string, func(*gorm.DB)) error
+		}{
+			{"create", cb.Create().Before("*").Register, cb.Create().After("*").Register},
+			{"query", cb.Query().Before("*").Register, cb.Query().After("*").Register},
+			{"update", cb.Update().Before("*").Register, cb.Update().After("*").Register},
+			{"delete", cb.Delete().Before("*").Register, cb.Delete().After("*").Register},
+			{"row", cb.Row().Before("*").Register, cb.Row().After("*").Register},
+			{"raw", cb.Raw().Before("*").Register, cb.Raw().After("*").Register},
+		}
+		for _, p := range processors {
+			if err := p.before("glue:trace_before", t.before(p.operation)); err != nil {
+				return err
+			}
+			if err := p.after("glue:trace_after", t.after); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type sqlTrace struct {
+	slowThreshold time.Duration
+	tracer        SQLTracer
+}
+
+func (t *sqlTrace) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		db.InstanceSet(traceStartKey, time.Now())
+		if t.tracer != nil {
+			db.InstanceSet(traceSpanKey, t.tracer.StartSpan(db.Statement.Context, operation))
+		}
+	}
+}
+
+func (t *sqlTrace) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(traceStartKey)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(v.(time.Time))
+
+	failed := db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)
+	slow := elapsed >= t.slowThreshold
+
+	var statement string
+	if failed || slow || t.tracer != nil {
+		statement = explainRedacted(db)
+	}
+	if span, ok := db.InstanceGet(traceSpanKey); ok {
+		span.(SQLSpan).Finish(statement, db.Statement.RowsAffected, db.Error)
+	}
+	if !failed && !slow {
+		return
+	}
+
+	entry := logrus.WithContext(db.Statement.Context).WithFields(logrus.Fields{
+		"sql":        statement,
+		"elapsed_ms": float64(elapsed.Microseconds()) / 1000,
+		"rows":       db.Statement.RowsAffected,
+		"caller":     sqlCaller(),
+	})
+	if failed {
+		entry.WithError(db.Error).Error("[glue][db] sql error")
+		return
+	}
+	entry.Warn("[glue][db] slow sql")
+}
+
+// explainRedacted 返回加密字段值脱敏后的 SQL 语句.
+func explainRedacted(db *gorm.DB) string {
+	stmt := db.Statement
+	sensitive := encryptedClauseValues(stmt)
+	vars := make([]interface{}, len(stmt.Vars))
+	for i, v := range stmt.Vars {
+		vars[i] = v
+		for _, s := range sensitive {
+			if reflect.DeepEqual(v, s) {
+				vars[i] = RedactedValue
+				break
+			}
+		}
+	}
+	return db.Dialector.Explain(stmt.SQL.String(), vars...)
+}
+
+// encryptedClauseValues 收集语句中加密字段对应的值.
+//
+// 支持 INSERT VALUES, UPDATE SET, WHERE 中的 Eq, Neq, IN 条件.
+// 原生 SQL 条件 (如: Where("phone = ?", v)) 无法识别字段, 不做处理.
+func encryptedClauseValues(stmt *gorm.Statement) []interface{} {
+	if stmt.Schema == nil {
+		return nil
+	}
+	columns := make(map[string]bool)
+	for _, field := range stmt.Schema.Fields {
+		if _, ok := field.Tag.Lookup(EncryptTagName); ok {
+			columns[field.DBName] = true
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	var values []interface{}
+	if c, ok := stmt.Clauses["VALUES"]; ok {
+		if v, ok := c.Expression.(clause.Values); ok {
+			for i, col := range v.Columns {
+				if !columns[col.Name] {
+					continue
+				}
+				for _, row := range v.Values {
+					if i < len(row) {
+						values = append(values, row[i])
+					}
+				}
+			}
+		}
+	}
+	if c, ok := stmt.Clauses["SET"]; ok {
+		if v, ok := c.Expression.(clause.Set); ok {
+			for _, a := range v {
+				if columns[a.Column.Name] {
+					values = append(values, a.Value)
+				}
+			}
+		}
+	}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if v, ok := c.Expression.(clause.Where); ok {
+			values = append(values, encryptedExprValues(columns, v.Exprs)...)
+		}
+	}
+	return values
+}
+
+func encryptedExprValues(columns map[string]bool, exprs []clause.Expression) []interface{} {
+	var values []interface{}
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if columns[clauseColumnName(e.Column)] {
+				values = append(values, e.Value)
+			}
+		case clause.Neq:
+			if columns[clauseColumnName(e.Column)] {
+				values = append(values, e.Value)
+			}
+		case clause.IN:
+			if columns[clauseColumnName(e.Column)] {
+				values = append(values, e.Values...)
+			}
+		case clause.AndConditions:
+			values = append(values, encryptedExprValues(columns, e.Exprs)...)
+		case clause.OrConditions:
+			values = append(values, encryptedExprValues(columns, e.Exprs)...)
+		case clause.NotConditions:
+			values = append(values, encryptedExprValues(columns, e.Exprs)...)
+		}
+	}
+	return values
+}
+
+func clauseColumnName(column interface{}) string {
+	switch c := column.(type) {
+	case clause.Column:
+		return c.Name
+	case string:
+		return c
+	}
+	return ""
+}
+
+// sourceDir 当前包源码目录.
+var sourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.ToSlash(filepath.Dir(file)) + "/"
+}()
+
+// sqlCaller 返回执行 SQL 语句的业务代码位置.
+//
+// 跳过 gorm.io 和当前包的调用栈.
+func sqlCaller() string {
+	for i := 2; i < 20; i++ {
+		_, file, line, ok := runtime.Caller(i)
+		if !ok {
+			break
+		}
+		file = filepath.ToSlash(file)
+		if strings.HasSuffix(file, "_test.go") ||
+			(!strings.Contains(file, "/gorm.io/") && !strings.HasPrefix(file, sourceDir)) {
+			return file + ":" + strconv.Itoa(line)
+		}
+	}
+	return ""
+}
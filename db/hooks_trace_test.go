@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type TestTraceModel struct {
+	ID    int64
+	Name  string
+	Phone string `encrypt:"aes"`
+}
+
+type testSQLTracer struct {
+	mut   sync.Mutex
+	spans []*testSQLSpan
+}
+
+type testSQLSpan struct {
+	operation  string
+	statement  string
+	rows       int64
+	err        error
+	finished   bool
+	contextKey interface{}
+}
+
+func (tr *testSQLTracer) StartSpan(ctx context.Context, operation string) SQLSpan {
+	tr.mut.Lock()
+	defer tr.mut.Unlock()
+	span := &testSQLSpan{operation: operation, contextKey: ctx.Value("trace_key")}
+	tr.spans = append(tr.spans, span)
+	return span
+}
+
+func (s *testSQLSpan) Finish(statement string, rowsAffected int64, err error) {
+	s.statement = statement
+	s.rows = rowsAffected
+	s.err = err
+	s.finished = true
+}
+
+func TestSQLTraceHook(t *testing.T) {
+	hook := test.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+
+	tracer := &testSQLTracer{}
+	dial := WithInitializeHook(testdb_dial(t),
+		CryptoHook(testCryptoMarshal, testCryptoUnmarshal),
+		SQLTraceHook(time.Nanosecond, tracer))
+	p := testdb_newprovider_with_dial(t, dial, "sql_trace")
+	ctx := context.WithValue(context.Background(), "trace_key", "trace_value")
+
+	if err := p.UseDB(ctx).AutoMigrate(&TestTraceModel{}); err != nil {
+		t.Fatal(err)
+	}
+	hook.Reset()
+	tracer.spans = nil
+
+	m := &TestTraceModel{ID: 1, Name: "name", Phone: "13800000000"}
+	if err := p.UseDB(ctx).Create(m).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatal("expect slow sql logged")
+	}
+	if entry.Level != logrus.WarnLevel {
+		t.Errorf("expect level: %v, got: %v", logrus.WarnLevel, entry.Level)
+	}
+	if entry.Context != ctx {
+		t.Error("expect log with statement context")
+	}
+	sql, _ := entry.Data["sql"].(string)
+	if !strings.Contains(sql, RedactedValue) || strings.Contains(sql, "13800000000") {
+		t.Errorf("expect encrypted field redacted, got: %s", sql)
+	}
+	if !strings.Contains(sql, "name") {
+		t.Errorf("expect plain field logged, got: %s", sql)
+	}
+	if rows := entry.Data["rows"]; rows != int64(1) {
+		t.Errorf("expect rows: 1, got: %v", rows)
+	}
+	if caller, _ := entry.Data["caller"].(string); !strings.Contains(caller, "hooks_trace_test.go") {
+		t.Errorf("expect caller in test file, got: %s", caller)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expect 1 span, got: %d", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if !span.finished || span.operation != "create" || span.rows != 1 {
+		t.Errorf("expect create span finished, got: %+v", span)
+	}
+	if span.contextKey != "trace_value" {
+		t.Errorf("expect span with statement context, got: %v", span.contextKey)
+	}
+}
+
+func TestSQLTraceHook_Threshold(t *testing.T) {
+	hook := test.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+
+	dial := WithInitializeHook(testdb_dial(t), SQLTraceHook(time.Hour, nil))
+	p := testdb_newprovider_with_dial(t, dial, "sql_trace_threshold")
+	ctx := context.Background()
+	hook.Reset()
+
+	if err := p.UseDB(ctx).First(&TestDBModel{}, testDefaultRecord.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("expect fast sql not logged, got: %v", hook.AllEntries())
+	}
+
+	p.UseDB(ctx).First(&TestDBModel{}, -1)
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("expect record not found not logged, got: %v", hook.AllEntries())
+	}
+
+	if err := p.UseDB(ctx).Table("not_exists_table").Find(&TestDBModel{}).Error; err == nil {
+		t.Fatal("expect error")
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.ErrorLevel {
+		t.Errorf("expect error sql logged, got: %v", entry)
+	}
+}
+
+func testCryptoMarshal(ctx context.Context, tag string, val string) (string, error) {
+	if val == "" {
+		return val, nil
+	}
+	return val + "_encrypted", nil
+}
+
+func testCryptoUnmarshal(ctx context.Context, tag string, val string) (string, error) {
+	return strings.TrimSuffix(val, "_encrypted"), nil
+}
@@ -0,0 +1,310 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrKeyIDNotFound = errors.New("encrypt key id not found")
+)
+
+// Keyring 定义加密密钥环.
+//
+// 每个租户有一个当前密钥用于加密, 历史密钥按 ID 保留用于解密.
+// 不记录密钥 ID 的密文(aes 模式与旧版 aes-gcm 密文)使用租户的 legacy 密钥.
+type Keyring interface {
+	// ActiveKey 返回 context 对应租户的当前密钥.
+	ActiveKey(ctx context.Context) (keyID string, key []byte, err error)
+	// LegacyKey 返回 context 对应租户的 legacy 密钥, 用于不记录密钥 ID 的密文.
+	//
+	// 未指定 legacy 密钥时返回当前密钥.
+	LegacyKey(ctx context.Context) ([]byte, error)
+	// Key 按密钥 ID 返回密钥.
+	//
+	// 密钥不存在返回 ErrKeyIDNotFound.
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// NewMemoryKeyring 创建内存密钥环.
+//
+// tenantFrom 从 context 获取租户, 为 nil 时所有 context 共享同一当前密钥.
+func NewMemoryKeyring(tenantFrom func(context.Context) string) *MemoryKeyring {
+	return &MemoryKeyring{
+		tenantFrom: tenantFrom,
+		keys:       make(map[string][]byte),
+		active:     make(map[string]string),
+		legacy:     make(map[string]string),
+	}
+}
+
+// MemoryKeyring 实现内存密钥环.
+type MemoryKeyring struct {
+	tenantFrom func(context.Context) string
+
+	mut sync.RWMutex
+	// 密钥 ID -> 密钥.
+	keys map[string][]byte
+	// 租户 -> 当前密钥 ID.
+	active map[string]string
+	// 租户 -> legacy 密钥 ID.
+	legacy map[string]string
+}
+
+var _ Keyring = new(MemoryKeyring)
+
+// AddKey 添加密钥.
+//
+// 密钥 ID 全局唯一, 重复添加覆盖原密钥.
+func (k *MemoryKeyring) AddKey(keyID string, key []byte) {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	k.keys[keyID] = key
+}
+
+// SetActive 设置租户当前密钥.
+func (k *MemoryKeyring) SetActive(tenant, keyID string) error {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyIDNotFound
+	}
+	k.active[tenant] = keyID
+	return nil
+}
+
+// SetLegacy 设置租户 legacy 密钥, 用于不记录密钥 ID 的密文.
+//
+// 首次轮换前需设置为原密钥, 否则轮换后原密文无法解密.
+func (k *MemoryKeyring) SetLegacy(tenant, keyID string) error {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyIDNotFound
+	}
+	k.legacy[tenant] = keyID
+	return nil
+}
+
+// ActiveKey 返回 context 对应租户的当前密钥.
+func (k *MemoryKeyring) ActiveKey(ctx context.Context) (string, []byte, error) {
+	var tenant string
+	if k.tenantFrom != nil {
+		tenant = k.tenantFrom(ctx)
+	}
+	k.mut.RLock()
+	defer k.mut.RUnlock()
+	keyID, ok := k.active[tenant]
+	if !ok {
+		return "", nil, ErrEncryptKeyNotFound
+	}
+	return keyID, k.keys[keyID], nil
+}
+
+// LegacyKey 返回 context 对应租户的 legacy 密钥, 未设置时返回当前密钥.
+func (k *MemoryKeyring) LegacyKey(ctx context.Context) ([]byte, error) {
+	var tenant string
+	if k.tenantFrom != nil {
+		tenant = k.tenantFrom(ctx)
+	}
+	k.mut.RLock()
+	keyID, ok := k.legacy[tenant]
+	k.mut.RUnlock()
+	if !ok {
+		_, key, err := k.ActiveKey(ctx)
+		return key, err
+	}
+	return k.Key(ctx, keyID)
+}
+
+// Key 按密钥 ID 返回密钥.
+func (k *MemoryKeyring) Key(_ context.Context, keyID string) ([]byte, error) {
+	k.mut.RLock()
+	defer k.mut.RUnlock()
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrKeyIDNotFound
+	}
+	return key, nil
+}
+
+// KeyringEncryptTagHandler 使用密钥环处理字段加密.
+//
+// tag       | 算法
+// "aes-gcm" | AES-GCM, 使用当前密钥, 密文记录密钥 ID
+// ""        | AES, 使用 legacy 密钥, 不支持密钥轮换
+// "true"    | AES, 使用 legacy 密钥, 不支持密钥轮换
+// "aes"     | AES, 使用 legacy 密钥, 不支持密钥轮换
+func KeyringEncryptTagHandler(kr Keyring) StringTagHandler {
+	legacy := EncryptTagHandler(legacyKeyFunc(kr))
+	return func(ctx context.Context, tagValue string, fieldValue string) (string, error) {
+		if tagValue != "aes-gcm" {
+			return legacy(ctx, tagValue, fieldValue)
+		}
+		keyID, key, err := kr.ActiveKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		encrypted, err := AESGCMEncryptWithKeyID([]byte(fieldValue), keyID, key)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(encrypted), nil
+	}
+}
+
+// KeyringDecryptTagHandler 使用密钥环处理字段解密.
+//
+// tag       | 算法
+// "aes-gcm" | AES-GCM, 按密文记录的密钥 ID 选择密钥, 未记录时使用 legacy 密钥
+// ""        | AES, 使用 legacy 密钥
+// "true"    | AES, 使用 legacy 密钥
+// "aes"     | AES, 使用 legacy 密钥
+func KeyringDecryptTagHandler(kr Keyring) StringTagHandler {
+	legacy := DecryptTagHandler(legacyKeyFunc(kr))
+	return func(ctx context.Context, tagValue string, fieldValue string) (string, error) {
+		if tagValue != "aes-gcm" {
+			return legacy(ctx, tagValue, fieldValue)
+		}
+		encrypted, err := base64.StdEncoding.DecodeString(fieldValue)
+		if err != nil {
+			return "", err
+		}
+		keyID, err := GCMCiphertextKeyID(encrypted)
+		if err != nil {
+			return "", err
+		}
+		var key []byte
+		if keyID == "" {
+			key, err = kr.LegacyKey(ctx)
+		} else {
+			key, err = kr.Key(ctx, keyID)
+		}
+		if err != nil {
+			return "", err
+		}
+		decrypted, err := AESGCMDecrypt(encrypted, key)
+		if err != nil {
+			return "", err
+		}
+		return string(decrypted), nil
+	}
+}
+
+// legacyKeyFunc 转换密钥环 legacy 密钥为 EncryptTagHandler 密钥函数.
+func legacyKeyFunc(kr Keyring) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		key, err := kr.LegacyKey(ctx)
+		if err != nil {
+			return "", err
+		}
+		return string(key), nil
+	}
+}
+
+// DefaultReEncryptBatchSize 默认重新加密批大小.
+var DefaultReEncryptBatchSize = 100
+
+// NewReEncryptJob 创建加密字段重新加密任务.
+//
+// model 为模型指针, 如: &User{}.
+// scopes 用于过滤需要处理的记录, 如: 按租户过滤.
+//
+// 任务按主键顺序分批读取记录(读取时按密文记录的密钥解密), 并使用当前密钥
+// 重新写入所有 encrypt 字段. 需在安装了 CryptoHook 的数据库上执行.
+// 不记录密钥 ID 的 aes-gcm 密文按 legacy 密钥解密, 重新写入后记录当前密钥 ID;
+// aes 模式字段始终使用 legacy 密钥.
+//
+// 例:
+//	job := NewReEncryptJob(provider, &User{}, 500, tenantScope)
+//	n, err := job.Run(tenantCtx)
+func NewReEncryptJob(p Provider, model interface{}, batchSize int, scopes ...func(*gorm.DB) *gorm.DB) *ReEncryptJob {
+	if batchSize <= 0 {
+		batchSize = DefaultReEncryptBatchSize
+	}
+	return &ReEncryptJob{
+		provider:  p,
+		model:     model,
+		batchSize: batchSize,
+		scopes:    scopes,
+	}
+}
+
+// ReEncryptJob 实现加密字段重新加密.
+type ReEncryptJob struct {
+	provider  Provider
+	model     interface{}
+	batchSize int
+	scopes    []func(*gorm.DB) *gorm.DB
+}
+
+// Run 执行重新加密, 返回处理的记录数.
+//
+// ctx 结束时在当前批次完成后停止, 返回 ctx.Err().
+func (j *ReEncryptJob) Run(ctx context.Context) (int64, error) {
+	db := j.provider.UseWriteDB(ctx)
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(j.model); err != nil {
+		return 0, err
+	}
+	sch := stmt.Schema
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("model %s has no primary key", sch.Name)
+	}
+	columns := encryptColumns(sch)
+	if len(columns) == 0 {
+		return 0, nil
+	}
+
+	var (
+		total int64
+		last  interface{}
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		rows := reflect.New(reflect.SliceOf(sch.ModelType))
+		query := j.provider.UseWriteDB(ctx).Model(j.model).Scopes(j.scopes...).
+			Order(fmt.Sprintf("%s ASC", stmt.Quote(pk.DBName))).Limit(j.batchSize)
+		if last != nil {
+			query = query.Where(fmt.Sprintf("%s > ?", stmt.Quote(pk.DBName)), last)
+		}
+		if err := query.Find(rows.Interface()).Error; err != nil {
+			return total, err
+		}
+
+		rv := rows.Elem()
+		for i := 0; i < rv.Len(); i++ {
+			row := rv.Index(i).Addr().Interface()
+			err := j.provider.UseWriteDB(ctx).Model(row).Select(columns).Updates(row).Error
+			if err != nil {
+				return total, err
+			}
+			total++
+			last, _ = pk.ValueOf(ctx, rv.Index(i))
+		}
+		if rv.Len() < j.batchSize {
+			return total, nil
+		}
+	}
+}
+
+// encryptColumns 返回标记 encrypt tag 的字段名.
+func encryptColumns(sch *schema.Schema) []string {
+	var columns []string
+	for _, field := range sch.Fields {
+		if _, ok := field.Tag.Lookup(EncryptTagName); ok && field.DBName != "" {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type TestKeyringModel struct {
+	ID    int64
+	Name  string
+	Phone string `encrypt:"aes-gcm"`
+}
+
+func testdb_keyring_tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value("tenant").(string)
+	return tenant
+}
+
+func TestKeyringTagHandler(t *testing.T) {
+	kr := NewMemoryKeyring(testdb_keyring_tenant)
+	kr.AddKey("k1", []byte(strings.Repeat("1", 16)))
+	kr.AddKey("k2", []byte(strings.Repeat("2", 16)))
+	if err := kr.SetActive("t1", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.SetActive("t1", "not_exists"); !errors.Is(err, ErrKeyIDNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrKeyIDNotFound, err)
+	}
+	encrypt := KeyringEncryptTagHandler(kr)
+	decrypt := KeyringDecryptTagHandler(kr)
+	ctx := context.WithValue(context.Background(), "tenant", "t1")
+
+	en, err := encrypt(ctx, "aes-gcm", "raw data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := base64.StdEncoding.DecodeString(en)
+	if id, _ := GCMCiphertextKeyID(b); id != "k1" {
+		t.Errorf("expect key id: k1, got: %s", id)
+	}
+
+	// 轮换后旧密文仍可解密.
+	if err := kr.SetActive("t1", "k2"); err != nil {
+		t.Fatal(err)
+	}
+	de, err := decrypt(ctx, "aes-gcm", en)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de != "raw data" {
+		t.Errorf("expect: raw data, got: %s", de)
+	}
+
+	if _, err := encrypt(context.Background(), "aes-gcm", "raw data"); !errors.Is(err, ErrEncryptKeyNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrEncryptKeyNotFound, err)
+	}
+
+	// 兼容无密钥 ID 的密文.
+	v1, err := EncryptTagHandler(func(context.Context) (string, error) {
+		return strings.Repeat("2", 16), nil
+	})(ctx, "aes-gcm", "v1 data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de, err := decrypt(ctx, "aes-gcm", v1); err != nil || de != "v1 data" {
+		t.Errorf("expect: v1 data, got: %s, %v", de, err)
+	}
+}
+
+func TestReEncryptJob(t *testing.T) {
+	kr := NewMemoryKeyring(nil)
+	kr.AddKey("k1", []byte(strings.Repeat("1", 16)))
+	kr.AddKey("k2", []byte(strings.Repeat("2", 16)))
+	if err := kr.SetActive("", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	dial := WithInitializeHook(testdb_dial(t), CryptoHook(KeyringEncryptTagHandler(kr), KeyringDecryptTagHandler(kr)))
+	p := testdb_newprovider_with_dial(t, dial, "reencrypt")
+	ctx := context.Background()
+
+	if err := p.UseDB(ctx).AutoMigrate(&TestKeyringModel{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := p.UseDB(ctx).Create(&TestKeyringModel{ID: int64(i), Name: "name", Phone: "phone"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := kr.SetActive("", "k2"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewReEncryptJob(p, &TestKeyringModel{}, 2).Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("expect 5 rows re-encrypted, got: %d", n)
+	}
+
+	var phones []string
+	p.UseDB(ctx).Table("test_keyring_models").Order("id").Pluck("phone", &phones)
+	for _, phone := range phones {
+		b, _ := base64.StdEncoding.DecodeString(phone)
+		if id, _ := GCMCiphertextKeyID(b); id != "k2" {
+			t.Errorf("expect key id: k2, got: %s", id)
+		}
+	}
+
+	var ms []TestKeyringModel
+	if err := p.UseDB(ctx).Find(&ms).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ms {
+		if m.Phone != "phone" || m.Name != "name" {
+			t.Errorf("unexpected model: %+v", m)
+		}
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := NewReEncryptJob(p, &TestKeyringModel{}, 2).Run(cctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expect: %v, got: %v", context.Canceled, err)
+	}
+}
+
+type TestKeyringLegacyModel struct {
+	ID      int64
+	Phone   string `encrypt:"aes-gcm"`
+	Address string `encrypt:"aes"`
+}
+
+func TestKeyringLegacyKey(t *testing.T) {
+	kr := NewMemoryKeyring(nil)
+	kr.AddKey("k1", []byte(strings.Repeat("1", 16)))
+	kr.AddKey("k2", []byte(strings.Repeat("2", 16)))
+	if err := kr.SetActive("", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	dial := WithInitializeHook(testdb_dial(t), CryptoHook(KeyringEncryptTagHandler(kr), KeyringDecryptTagHandler(kr)))
+	p := testdb_newprovider_with_dial(t, dial, "keyring_legacy")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestKeyringLegacyModel{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 引入密钥环前使用 k1 加密的密文, 不记录密钥 ID.
+	v1 := EncryptTagHandler(func(context.Context) (string, error) {
+		return strings.Repeat("1", 16), nil
+	})
+	phone, err := v1(ctx, "aes-gcm", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := v1(ctx, "aes", "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.UseDB(ctx).Exec("INSERT INTO test_keyring_legacy_models (id, phone, address) VALUES (?, ?, ?)", 1, phone, address).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kr.SetLegacy("", "not_exists"); !errors.Is(err, ErrKeyIDNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrKeyIDNotFound, err)
+	}
+	if err := kr.SetLegacy("", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.SetActive("", "k2"); err != nil {
+		t.Fatal(err)
+	}
+	check := func() {
+		t.Helper()
+		m := &TestKeyringLegacyModel{}
+		if err := p.UseDB(ctx).First(m, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		if m.Phone != "phone" || m.Address != "address" {
+			t.Errorf("unexpected model: %+v", m)
+		}
+	}
+	// 轮换后旧密文按 legacy 密钥解密.
+	check()
+
+	if _, err := NewReEncryptJob(p, &TestKeyringLegacyModel{}, 10).Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var phones []string
+	p.UseDB(ctx).Table("test_keyring_legacy_models").Pluck("phone", &phones)
+	b, _ := base64.StdEncoding.DecodeString(phones[0])
+	if id, _ := GCMCiphertextKeyID(b); id != "k2" {
+		t.Errorf("expect re-encrypted with key id: k2, got: %s", id)
+	}
+	check()
+}
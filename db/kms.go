@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/agztizoo/glue/timeservice"
+)
+
+var (
+	// DefaultDataKeyTTL 解密后数据密钥默认缓存时间.
+	DefaultDataKeyTTL = 10 * time.Minute
+
+	ErrMasterKeyNotFound = errors.New("master key not found")
+)
+
+// KeyProvider 定义密钥管理服务 (KMS), 实现信封加密.
+//
+// 字段使用数据密钥加密, 数据密钥由 KMS 中的主密钥加密后保存在配置中.
+// 应用只持有加密后的数据密钥, 使用时通过 KMS 解密.
+type KeyProvider interface {
+	// GenerateDataKey 生成数据密钥.
+	//
+	// 返回数据密钥明文和使用主密钥加密后的数据密钥.
+	GenerateDataKey(ctx context.Context, masterKeyID string) (plaintext []byte, wrapped []byte, err error)
+	// DecryptDataKey 使用主密钥解密数据密钥.
+	//
+	// 主密钥不存在返回 ErrMasterKeyNotFound.
+	DecryptDataKey(ctx context.Context, masterKeyID string, wrapped []byte) ([]byte, error)
+}
+
+// WrappedDataKey 代表主密钥加密后的数据密钥.
+type WrappedDataKey struct {
+	// 主密钥 ID.
+	MasterKeyID string `yaml:"master_key_id"`
+	// 加密后的数据密钥, base64 编码.
+	Ciphertext string `yaml:"ciphertext"`
+}
+
+// GenerateWrappedDataKey 生成数据密钥, 返回加密后的数据密钥用于保存.
+func GenerateWrappedDataKey(ctx context.Context, kp KeyProvider, masterKeyID string) (*WrappedDataKey, error) {
+	_, wrapped, err := kp.GenerateDataKey(ctx, masterKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return &WrappedDataKey{
+		MasterKeyID: masterKeyID,
+		Ciphertext:  base64.StdEncoding.EncodeToString(wrapped),
+	}, nil
+}
+
+// NewDataKeyCache 创建数据密钥缓存.
+//
+// 解密后的数据密钥缓存 ttl 时间, 减少 KMS 调用. ttl 为 0 时使用 DefaultDataKeyTTL.
+func NewDataKeyCache(kp KeyProvider, ttl time.Duration) *DataKeyCache {
+	if ttl <= 0 {
+		ttl = DefaultDataKeyTTL
+	}
+	return &DataKeyCache{
+		provider: kp,
+		ttl:      ttl,
+		ts:       timeservice.NewTimeService(),
+		entries:  make(map[WrappedDataKey]*dataKeyEntry),
+	}
+}
+
+// DataKeyCache 实现数据密钥解密缓存.
+type DataKeyCache struct {
+	provider KeyProvider
+	ttl      time.Duration
+	ts       timeservice.TimeService
+
+	mut     sync.Mutex
+	entries map[WrappedDataKey]*dataKeyEntry
+}
+
+type dataKeyEntry struct {
+	key      []byte
+	expireAt time.Time
+}
+
+// Unwrap 返回数据密钥明文.
+func (c *DataKeyCache) Unwrap(ctx context.Context, wk *WrappedDataKey) ([]byte, error) {
+	if wk == nil {
+		return nil, ErrEncryptKeyNotFound
+	}
+	now := c.ts.Now()
+	c.mut.Lock()
+	if e, ok := c.entries[*wk]; ok && now.Before(e.expireAt) {
+		c.mut.Unlock()
+		return e.key, nil
+	}
+	c.mut.Unlock()
+
+	wrapped, err := base64.StdEncoding.DecodeString(wk.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key: %w", err)
+	}
+	key, err := c.provider.DecryptDataKey(ctx, wk.MasterKeyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for k, e := range c.entries {
+		if !now.Before(e.expireAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[*wk] = &dataKeyEntry{key: key, expireAt: now.Add(c.ttl)}
+	return key, nil
+}
+
+// DataKeyFunc 返回基于信封加密的密钥函数.
+//
+// keyOf 返回 context 对应的加密数据密钥, 通常来自配置.
+// 返回的函数可直接用于 EncryptTagHandler, DecryptTagHandler 和 WithBlindIndex.
+//
+// 例:
+//	keyf := DataKeyFunc(NewDataKeyCache(kms, 0), tenantDataKey)
+//	cryptoHook := CryptoHook(EncryptTagHandler(keyf), DecryptTagHandler(keyf))
+func DataKeyFunc(cache *DataKeyCache, keyOf func(ctx context.Context) (*WrappedDataKey, error)) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		wk, err := keyOf(ctx)
+		if err != nil {
+			return "", err
+		}
+		key, err := cache.Unwrap(ctx, wk)
+		if err != nil {
+			return "", err
+		}
+		return string(key), nil
+	}
+}
+
+// NewEnvelopeKeyring 创建信封加密密钥环.
+//
+// 密钥环只保存加密后的数据密钥, 使用时通过 cache 解密.
+// tenantFrom 从 context 获取租户, 为 nil 时所有 context 共享同一当前密钥.
+func NewEnvelopeKeyring(cache *DataKeyCache, tenantFrom func(context.Context) string) *EnvelopeKeyring {
+	return &EnvelopeKeyring{
+		cache:      cache,
+		tenantFrom: tenantFrom,
+		keys:       make(map[string]*WrappedDataKey),
+		active:     make(map[string]string),
+		legacy:     make(map[string]string),
+	}
+}
+
+// EnvelopeKeyring 实现信封加密密钥环.
+type EnvelopeKeyring struct {
+	cache      *DataKeyCache
+	tenantFrom func(context.Context) string
+
+	mut sync.RWMutex
+	// 密钥 ID -> 加密后的数据密钥.
+	keys map[string]*WrappedDataKey
+	// 租户 -> 当前密钥 ID.
+	active map[string]string
+	// 租户 -> legacy 密钥 ID.
+	legacy map[string]string
+}
+
+var _ Keyring = new(EnvelopeKeyring)
+
+// AddKey 添加加密后的数据密钥.
+//
+// 密钥 ID 全局唯一, 重复添加覆盖原密钥.
+func (k *EnvelopeKeyring) AddKey(keyID string, key *WrappedDataKey) {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	k.keys[keyID] = key
+}
+
+// SetActive 设置租户当前密钥.
+func (k *EnvelopeKeyring) SetActive(tenant, keyID string) error {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyIDNotFound
+	}
+	k.active[tenant] = keyID
+	return nil
+}
+
+// SetLegacy 设置租户 legacy 密钥, 用于不记录密钥 ID 的密文.
+func (k *EnvelopeKeyring) SetLegacy(tenant, keyID string) error {
+	k.mut.Lock()
+	defer k.mut.Unlock()
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyIDNotFound
+	}
+	k.legacy[tenant] = keyID
+	return nil
+}
+
+// ActiveKey 返回 context 对应租户的当前密钥.
+func (k *EnvelopeKeyring) ActiveKey(ctx context.Context) (string, []byte, error) {
+	var tenant string
+	if k.tenantFrom != nil {
+		tenant = k.tenantFrom(ctx)
+	}
+	k.mut.RLock()
+	keyID, ok := k.active[tenant]
+	wk := k.keys[keyID]
+	k.mut.RUnlock()
+	if !ok {
+		return "", nil, ErrEncryptKeyNotFound
+	}
+	key, err := k.cache.Unwrap(ctx, wk)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, key, nil
+}
+
+// Key 按密钥 ID 返回密钥.
+func (k *EnvelopeKeyring) Key(ctx context.Context, keyID string) ([]byte, error) {
+	k.mut.RLock()
+	wk, ok := k.keys[keyID]
+	k.mut.RUnlock()
+	if !ok {
+		return nil, ErrKeyIDNotFound
+	}
+	return k.cache.Unwrap(ctx, wk)
+}
+
+// LegacyKey 返回 context 对应租户的 legacy 密钥, 未设置时返回当前密钥.
+func (k *EnvelopeKeyring) LegacyKey(ctx context.Context) ([]byte, error) {
+	var tenant string
+	if k.tenantFrom != nil {
+		tenant = k.tenantFrom(ctx)
+	}
+	k.mut.RLock()
+	keyID, ok := k.legacy[tenant]
+	k.mut.RUnlock()
+	if !ok {
+		_, key, err := k.ActiveKey(ctx)
+		return key, err
+	}
+	return k.Key(ctx, keyID)
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+
+	"github.com/jinzhu/configor"
+
+	"github.com/agztizoo/glue/env"
+)
+
+// DataKeySize 数据密钥长度, AES-256.
+var DataKeySize = 32
+
+// FileKeyOptions 代表本地文件 KMS 配置.
+//
+// 例:
+//	master_keys:
+//	  dev: 32 字节主密钥 base64 编码
+type FileKeyOptions struct {
+	// 主密钥 ID -> base64 编码的主密钥.
+	MasterKeys map[string]string `yaml:"master_keys"`
+}
+
+// NewFileKeyProvider 从本地文件加载主密钥, 创建 KMS.
+//
+// 仅用于开发和测试, 生产环境应使用云 KMS.
+// 相对路径基于 env.WorkDir().
+func NewFileKeyProvider(file string) (*LocalKeyProvider, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(env.WorkDir(), file)
+	}
+	opts := &FileKeyOptions{}
+	if err := configor.New(&configor.Config{ErrorOnUnmatchedKeys: true}).Load(opts, file); err != nil {
+		return nil, err
+	}
+	return NewLocalKeyProvider(opts)
+}
+
+// NewLocalKeyProvider 创建本地 KMS.
+func NewLocalKeyProvider(opts *FileKeyOptions) (*LocalKeyProvider, error) {
+	keys := make(map[string][]byte, len(opts.MasterKeys))
+	for id, encoded := range opts.MasterKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", id, err)
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("master key %s: invalid key size %d", id, len(key))
+		}
+		keys[id] = key
+	}
+	return &LocalKeyProvider{keys: keys}, nil
+}
+
+// LocalKeyProvider 实现本地 KMS.
+//
+// 使用 AES-GCM 加密数据密钥, 主密钥 ID 作为附加认证数据.
+type LocalKeyProvider struct {
+	keys map[string][]byte
+}
+
+var _ KeyProvider = new(LocalKeyProvider)
+
+// GenerateDataKey 生成数据密钥.
+func (p *LocalKeyProvider) GenerateDataKey(_ context.Context, masterKeyID string) ([]byte, []byte, error) {
+	master, ok := p.keys[masterKeyID]
+	if !ok {
+		return nil, nil, ErrMasterKeyNotFound
+	}
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := AESGCMEncryptWithKeyID(key, masterKeyID, master)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, wrapped, nil
+}
+
+// DecryptDataKey 使用主密钥解密数据密钥.
+func (p *LocalKeyProvider) DecryptDataKey(_ context.Context, masterKeyID string, wrapped []byte) ([]byte, error) {
+	master, ok := p.keys[masterKeyID]
+	if !ok {
+		return nil, ErrMasterKeyNotFound
+	}
+	keyID, err := GCMCiphertextKeyID(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if keyID != masterKeyID {
+		return nil, fmt.Errorf("%w: wrapped by %s", ErrMasterKeyNotFound, keyID)
+	}
+	return AESGCMDecrypt(wrapped, master)
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testKMSClock struct {
+	now time.Time
+}
+
+func (c *testKMSClock) Now() time.Time {
+	return c.now
+}
+
+type testCountingKeyProvider struct {
+	KeyProvider
+	decrypts int
+}
+
+func (p *testCountingKeyProvider) DecryptDataKey(ctx context.Context, masterKeyID string, wrapped []byte) ([]byte, error) {
+	p.decrypts++
+	return p.KeyProvider.DecryptDataKey(ctx, masterKeyID, wrapped)
+}
+
+func testdb_file_key_provider(t *testing.T) *LocalKeyProvider {
+	file := filepath.Join(t.TempDir(), "kms.yml")
+	content := "master_keys:\n" +
+		"  dev: " + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("m", 32))) + "\n" +
+		"  other: " + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("o", 16))) + "\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kp, err := NewFileKeyProvider(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	kp := testdb_file_key_provider(t)
+	ctx := context.Background()
+
+	key, wrapped, err := kp.GenerateDataKey(ctx, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != DataKeySize {
+		t.Errorf("expect key size: %d, got: %d", DataKeySize, len(key))
+	}
+	got, err := kp.DecryptDataKey(ctx, "dev", wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(key) {
+		t.Error("unexpected unwrapped data key")
+	}
+
+	if _, _, err := kp.GenerateDataKey(ctx, "not_exists"); !errors.Is(err, ErrMasterKeyNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrMasterKeyNotFound, err)
+	}
+	if _, err := kp.DecryptDataKey(ctx, "other", wrapped); !errors.Is(err, ErrMasterKeyNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrMasterKeyNotFound, err)
+	}
+
+	if _, err := NewLocalKeyProvider(&FileKeyOptions{MasterKeys: map[string]string{"bad": "c2hvcnQ="}}); err == nil {
+		t.Error("expect error of invalid master key size")
+	}
+}
+
+func TestDataKeyFunc(t *testing.T) {
+	kp := &testCountingKeyProvider{KeyProvider: testdb_file_key_provider(t)}
+	ctx := context.Background()
+	wk, err := GenerateWrappedDataKey(ctx, kp, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &testKMSClock{now: time.Unix(0, 0)}
+	cache := NewDataKeyCache(kp, time.Minute)
+	cache.ts = clock
+	keyf := DataKeyFunc(cache, func(context.Context) (*WrappedDataKey, error) { return wk, nil })
+
+	en, err := EncryptTagHandler(keyf)(ctx, "aes-gcm", "raw data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	de, err := DecryptTagHandler(keyf)(ctx, "aes-gcm", en)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de != "raw data" {
+		t.Errorf("expect: raw data, got: %s", de)
+	}
+	if kp.decrypts != 1 {
+		t.Errorf("expect data key cached, decrypts: %d", kp.decrypts)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if _, err := keyf(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if kp.decrypts != 2 {
+		t.Errorf("expect data key expired, decrypts: %d", kp.decrypts)
+	}
+
+	bad := DataKeyFunc(cache, func(context.Context) (*WrappedDataKey, error) {
+		return &WrappedDataKey{MasterKeyID: "other", Ciphertext: wk.Ciphertext}, nil
+	})
+	if _, err := bad(ctx); !errors.Is(err, ErrMasterKeyNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrMasterKeyNotFound, err)
+	}
+}
+
+func TestEnvelopeKeyring(t *testing.T) {
+	kp := testdb_file_key_provider(t)
+	ctx := context.Background()
+	kr := NewEnvelopeKeyring(NewDataKeyCache(kp, 0), nil)
+	for _, id := range []string{"k1", "k2"} {
+		wk, err := GenerateWrappedDataKey(ctx, kp, "dev")
+		if err != nil {
+			t.Fatal(err)
+		}
+		kr.AddKey(id, wk)
+	}
+	if err := kr.SetActive("", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.SetActive("", "not_exists"); !errors.Is(err, ErrKeyIDNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrKeyIDNotFound, err)
+	}
+
+	en, err := KeyringEncryptTagHandler(kr)(ctx, "aes-gcm", "raw data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.SetActive("", "k2"); err != nil {
+		t.Fatal(err)
+	}
+	de, err := KeyringDecryptTagHandler(kr)(ctx, "aes-gcm", en)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if de != "raw data" {
+		t.Errorf("expect: raw data, got: %s", de)
+	}
+	if _, err := kr.Key(ctx, "not_exists"); !errors.Is(err, ErrKeyIDNotFound) {
+		t.Errorf("expect: %v, got: %v", ErrKeyIDNotFound, err)
+	}
+}
+
+func TestCryptoHook_DataKey(t *testing.T) {
+	kp := testdb_file_key_provider(t)
+	ctx := context.Background()
+	wk, err := GenerateWrappedDataKey(ctx, kp, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyf := DataKeyFunc(NewDataKeyCache(kp, 0), func(context.Context) (*WrappedDataKey, error) { return wk, nil })
+	dial := WithInitializeHook(testdb_dial(t), CryptoHook(EncryptTagHandler(keyf), DecryptTagHandler(keyf)))
+	p := testdb_newprovider_with_dial(t, dial, "crypto_hook_data_key")
+	if err := p.UseDB(ctx).AutoMigrate(&TestGCMCryptoModel{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据密钥为 32 字节, aes 字段同样可以加解密.
+	if err := p.UseDB(ctx).Create(&TestGCMCryptoModel{ID: 1, Legacy: "legacy", Phone: "phone"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var raw struct{ Legacy, Phone string }
+	p.UseDB(ctx).Table("test_gcm_crypto_models").Where("id = ?", 1).Scan(&raw)
+	if raw.Legacy == "legacy" || raw.Phone == "phone" {
+		t.Errorf("expect encrypted, got: %+v", raw)
+	}
+	got := &TestGCMCryptoModel{}
+	if err := p.UseDB(ctx).First(got, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Legacy != "legacy" || got.Phone != "phone" {
+		t.Errorf("unexpected model: %+v", got)
+	}
+}
@@ -0,0 +1,442 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrDBNotConfigured = errors.New("database not configured")
+	ErrLazyDBsClosed   = errors.New("lazy databases closed")
+)
+
+// NewLazyDBs 创建按 key 延迟打开的数据库集合.
+//
+// idleTimeout 大于 0 时, CloseIdle 关闭空闲超过 idleTimeout 的连接池.
+func NewLazyDBs(opts MultiOptions, dial Dialector, config *gorm.Config, idleTimeout time.Duration) *LazyDBs {
+	l := &LazyDBs{
+		dial:        dial,
+		config:      config,
+		idleTimeout: idleTimeout,
+		entries:     make(map[string]*lazyEntry),
+		now:         time.Now,
+	}
+	l.Update(opts)
+	return l
+}
+
+// LazyDBs 管理按 key 延迟打开的数据库, 用于大量租户数据库的场景.
+//
+// 1. 首次访问 key 时打开连接池, 并发首次访问只打开一次.
+// 2. 空闲超过 idleTimeout 且无使用中连接的连接池由 CloseIdle 关闭, 再次访问时重新打开.
+//    Get, Route 返回的 *gorm.DB 只在单次请求内使用, 不要长期持有.
+// 3. 运行时通过 Set, Remove, Update 增加, 删除租户数据库.
+//
+// 例:
+//	dbs := db.NewLazyDBs(opts, mysql.Dialector, &gorm.Config{}, 10*time.Minute)
+//	go dbs.Run(ctx, time.Minute)
+//	source := db.NewSourceWithFunc(router, dbs.Route(router))
+//	di.OnStop(dbs.Close)
+type LazyDBs struct {
+	mut         sync.Mutex
+	dial        Dialector
+	config      *gorm.Config
+	idleTimeout time.Duration
+	entries     map[string]*lazyEntry
+	closed      bool
+	// 用于测试插桩.
+	now func() time.Time
+}
+
+type lazyEntry struct {
+	opts *Options
+	// 最近一次打开, 未打开或已关闭时为 nil.
+	open     *lazyOpen
+	lastUsed time.Time
+}
+
+// lazyOpen 代表一次打开, 并发访问共享同一次打开的结果.
+type lazyOpen struct {
+	// 打开完成后关闭, db, err 在关闭前写入.
+	ready chan struct{}
+	db    *gorm.DB
+	err   error
+}
+
+func (o *lazyOpen) done() bool {
+	select {
+	case <-o.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// ToLazySource 转换配置为延迟打开的数据源.
+func (o MultiOptions) ToLazySource(dial Dialector, config *gorm.Config, router func(context.Context) string, idleTimeout time.Duration) (Source, *LazyDBs) {
+	dbs := NewLazyDBs(o, dial, config, idleTimeout)
+	return NewSourceWithFunc(router, dbs.Route(router)), dbs
+}
+
+// Route 创建按 key 路由数据库工厂函数, 同 RouteWithKey, 首次访问时打开数据库.
+//
+// key 未配置时返回 nil, 同 RouteWithKey.
+// 打开失败或已关闭时返回携带该错误的 *gorm.DB, 执行语句和开启事务返回该错误.
+func (l *LazyDBs) Route(nameFrom func(context.Context) string) func(context.Context) *gorm.DB {
+	return func(ctx context.Context) *gorm.DB {
+		name := nameFrom(ctx)
+		db, err := l.Get(name)
+		if errors.Is(err, ErrDBNotConfigured) {
+			return nil
+		}
+		if err != nil {
+			logrus.Warnf("[glue][db] failed to open database: %s, error: %v", name, err)
+			return openErrorDB(err)
+		}
+		return db
+	}
+}
+
+// Get 返回 key 对应的数据库, 未打开时打开.
+//
+// 并发访问等待同一次打开, 打开失败时共享该次错误.
+// 不缓存错误, 打开失败后的下一次访问重新打开.
+//
+// 返回的 *gorm.DB 可能被 CloseIdle, Set, Remove, Update 关闭, 关闭后执行语句返回 sql: database is closed.
+func (l *LazyDBs) Get(name string) (*gorm.DB, error) {
+	l.mut.Lock()
+	if l.closed {
+		l.mut.Unlock()
+		return nil, ErrLazyDBsClosed
+	}
+	e, ok := l.entries[name]
+	if !ok {
+		l.mut.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrDBNotConfigured, name)
+	}
+	e.lastUsed = l.now()
+	if o := e.open; o != nil && (!o.done() || o.err == nil) {
+		l.mut.Unlock()
+		<-o.ready
+		return o.db, o.err
+	}
+	o := &lazyOpen{ready: make(chan struct{})}
+	e.open = o
+	l.mut.Unlock()
+	return l.openEntry(name, e, o)
+}
+
+func (l *LazyDBs) openEntry(name string, e *lazyEntry, o *lazyOpen) (*gorm.DB, error) {
+	db, err := e.opts.OpenDB(l.dial, l.config)
+
+	// 持有锁写入结果, 删除或替换在写入前发生时由此处关闭, 在写入后发生时由 closeLazyEntries 关闭.
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.entries[name] != e && err == nil {
+		if cerr := closeGormDB(db); cerr != nil {
+			logrus.Warnf("[glue][db] failed to close database: %s, error: %v", name, cerr)
+		}
+		db, err = nil, fmt.Errorf("%w: %s", ErrDBNotConfigured, name)
+	}
+	o.db, o.err = db, err
+	close(o.ready)
+	return db, err
+}
+
+// Names 返回已配置的 key, 按名称升序.
+func (l *LazyDBs) Names() []string {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	names := make([]string, 0, len(l.entries))
+	for name := range l.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set 增加或替换 key 对应的配置, 替换时关闭已打开的连接池, 返回关闭错误.
+//
+// 打开中的连接池在打开完成后关闭, 不等待.
+func (l *LazyDBs) Set(name string, opts *Options) error {
+	l.mut.Lock()
+	old := l.entries[name]
+	l.entries[name] = &lazyEntry{opts: opts}
+	l.mut.Unlock()
+	return closeLazyEntries(context.Background(), map[string]*lazyEntry{name: old}, false)
+}
+
+// Remove 删除 key 对应的配置, 并关闭已打开的连接池, 返回关闭错误.
+//
+// 打开中的连接池在打开完成后关闭, 不等待.
+func (l *LazyDBs) Remove(name string) error {
+	l.mut.Lock()
+	old := l.entries[name]
+	delete(l.entries, name)
+	l.mut.Unlock()
+	return closeLazyEntries(context.Background(), map[string]*lazyEntry{name: old}, false)
+}
+
+// Update 按新配置增加, 删除租户数据库, 用于配置重新加载, 返回关闭错误.
+//
+// 配置未变化的 key 保留已打开的连接池. 打开中的连接池在打开完成后关闭, 不等待.
+func (l *LazyDBs) Update(opts MultiOptions) error {
+	l.mut.Lock()
+	stale := make(map[string]*lazyEntry)
+	for name, e := range l.entries {
+		if o, ok := opts[name]; !ok || o == nil || !reflect.DeepEqual(o, e.opts) {
+			stale[name] = e
+			delete(l.entries, name)
+		}
+	}
+	for name, o := range opts {
+		if _, ok := l.entries[name]; !ok && o != nil {
+			l.entries[name] = &lazyEntry{opts: o}
+		}
+	}
+	l.mut.Unlock()
+	return closeLazyEntries(context.Background(), stale, false)
+}
+
+// CloseIdle 关闭空闲超过 idleTimeout 且无使用中连接的连接池, 返回关闭的 key.
+//
+// 只检查连接池是否有使用中的连接, 不追踪调用方持有的 *gorm.DB.
+// 调用方持有超过 idleTimeout 的 *gorm.DB 可能已被关闭, 应在每次请求时通过 Get 或 Route 获取.
+func (l *LazyDBs) CloseIdle() []string {
+	if l.idleTimeout <= 0 {
+		return nil
+	}
+	l.mut.Lock()
+	var names []string
+	idle := make(map[string]*gorm.DB)
+	now := l.now()
+	for name, e := range l.entries {
+		if !l.isIdle(e, now) {
+			continue
+		}
+		names = append(names, name)
+		idle[name] = e.open.db
+		e.open = nil
+	}
+	l.mut.Unlock()
+	for name, db := range idle {
+		if err := closeGormDB(db); err != nil {
+			logrus.Warnf("[glue][db] failed to close idle database: %s, error: %v", name, err)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *LazyDBs) isIdle(e *lazyEntry, now time.Time) bool {
+	// 等待打开完成的连接池不关闭.
+	if e.open == nil || !e.open.done() || e.open.db == nil || now.Sub(e.lastUsed) < l.idleTimeout {
+		return false
+	}
+	d, err := e.open.db.DB()
+	return err == nil && d.Stats().InUse == 0
+}
+
+// Run 每隔 interval 执行 CloseIdle, 直到 ctx 结束.
+func (l *LazyDBs) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.CloseIdle()
+		}
+	}
+}
+
+// Close 关闭所有已打开的连接池, 关闭后 Get 返回 ErrLazyDBsClosed.
+//
+// 等待打开中的连接池打开完成后关闭, ctx 先结束时返回 ctx.Err(), 剩余连接池在打开完成后关闭.
+// 返回合并后的关闭错误, 支持 errors.Is.
+func (l *LazyDBs) Close(ctx context.Context) error {
+	l.mut.Lock()
+	l.closed = true
+	entries := l.entries
+	l.entries = make(map[string]*lazyEntry)
+	l.mut.Unlock()
+	return closeLazyEntries(ctx, entries, true)
+}
+
+// closeLazyEntries 关闭已从集合中删除的条目的连接池, 返回合并后的关闭错误.
+//
+// wait 为 true 时等待打开中的连接池打开完成或 ctx 结束, 否则不等待.
+// 未等待到的连接池由 openEntry 在打开完成后关闭.
+func closeLazyEntries(ctx context.Context, entries map[string]*lazyEntry, wait bool) error {
+	var (
+		errs    []error
+		pending bool
+	)
+	for name, e := range entries {
+		if e == nil || e.open == nil {
+			continue
+		}
+		o := e.open
+		if wait {
+			select {
+			case <-o.ready:
+			case <-ctx.Done():
+			}
+		}
+		if !o.done() {
+			pending = true
+			continue
+		}
+		if o.err != nil {
+			continue
+		}
+		if err := closeGormDB(o.db); err != nil {
+			errs = append(errs, fmt.Errorf("close database %s: %w", name, err))
+		}
+	}
+	if wait && pending {
+		errs = append(errs, ctx.Err())
+	}
+	return joinErrors(errs)
+}
+
+func closeGormDB(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	d, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return d.Close()
+}
+
+// multiError 合并多个错误, errors.Is, errors.As 匹配任意一个错误.
+type multiError []error
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m multiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiError) As(target interface{}) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors 合并错误, 无错误时返回 nil, 只有一个错误时返回该错误.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return multiError(errs)
+}
+
+// openErrorDB 返回携带 err 的 *gorm.DB, 执行语句和开启事务返回 err, 用于路由到打开失败的数据库.
+func openErrorDB(err error) *gorm.DB {
+	db, oerr := gorm.Open(errorDialector{err: err}, &gorm.Config{Logger: logger.Discard})
+	if oerr != nil {
+		panic(oerr)
+	}
+	_ = db.AddError(err)
+	return db
+}
+
+// errorDialector 不连接数据库, 连接池所有操作返回 err.
+type errorDialector struct {
+	err error
+}
+
+func (d errorDialector) Name() string {
+	return "error"
+}
+
+func (d errorDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = errorConnPool(d)
+	return nil
+}
+
+func (d errorDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator.Migrator{Config: migrator.Config{DB: db, Dialector: d}}
+}
+
+func (d errorDialector) DataTypeOf(field *schema.Field) string {
+	return string(field.DataType)
+}
+
+func (d errorDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (d errorDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	_ = writer.WriteByte('?')
+}
+
+func (d errorDialector) QuoteTo(writer clause.Writer, str string) {
+	_, _ = writer.WriteString(str)
+}
+
+func (d errorDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, "'", vars...)
+}
+
+type errorConnPool struct {
+	err error
+}
+
+func (p errorConnPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, p.err
+}
+
+func (p errorConnPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, p.err
+}
+
+func (p errorConnPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, p.err
+}
+
+// QueryRowContext 无法构造携带错误的 *sql.Row, *gorm.DB 已携带 err, 语句回调不会执行到此处.
+func (p errorConnPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func (p errorConnPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return nil, p.err
+}
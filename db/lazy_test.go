@@ -0,0 +1,288 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLazyDBs(t *testing.T) {
+	dir := t.TempDir()
+	var opened int32
+	dial := func(opts *Options) (gorm.Dialector, error) {
+		if opts.DBName == "" {
+			return nil, errors.New("database name not exits")
+		}
+		atomic.AddInt32(&opened, 1)
+		return sqlite.Open(filepath.Join(dir, opts.DBName)), nil
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dbs := NewLazyDBs(MultiOptions{
+		"a": {DBName: "a.db"},
+		"b": {DBName: "b.db"},
+		"e": {},
+	}, dial, nil, time.Minute)
+	dbs.now = func() time.Time { return now }
+	defer dbs.Close(context.Background())
+
+	if n := atomic.LoadInt32(&opened); n != 0 {
+		t.Fatalf("expect no database opened before access, got: %d", n)
+	}
+
+	t.Run("open once", func(t *testing.T) {
+		var wg sync.WaitGroup
+		res := make([]*gorm.DB, 10)
+		for i := range res {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				db, err := dbs.Get("a")
+				if err != nil {
+					t.Error(err)
+				}
+				res[i] = db
+			}(i)
+		}
+		wg.Wait()
+		if n := atomic.LoadInt32(&opened); n != 1 {
+			t.Errorf("expect opened once, got: %d", n)
+		}
+		for _, db := range res {
+			if db != res[0] {
+				t.Errorf("expect same database")
+			}
+		}
+	})
+
+	t.Run("route", func(t *testing.T) {
+		route := dbs.Route(testdb_router)
+		if db := route(testdb_new_context_with_dbname("b")); db == nil {
+			t.Errorf("expect database b")
+		}
+		if db := route(testdb_new_context_with_dbname("unknown")); db != nil {
+			t.Errorf("expect nil for unknown key")
+		}
+		if _, err := dbs.Get("unknown"); !errors.Is(err, ErrDBNotConfigured) {
+			t.Errorf("expect: %v, got: %v", ErrDBNotConfigured, err)
+		}
+		// 打开失败不缓存.
+		if _, err := dbs.Get("e"); err == nil {
+			t.Errorf("expect open error")
+		}
+		dbs.Set("e", &Options{DBName: "e.db"})
+		if _, err := dbs.Get("e"); err != nil {
+			t.Errorf("expect opened after fixed, got: %v", err)
+		}
+	})
+
+	t.Run("close idle", func(t *testing.T) {
+		a, _ := dbs.Get("a")
+		now = now.Add(30 * time.Second)
+		if _, err := dbs.Get("b"); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(40 * time.Second)
+		closed := dbs.CloseIdle()
+		if len(closed) != 2 || closed[0] != "a" || closed[1] != "e" {
+			t.Errorf("unexpected closed: %v", closed)
+		}
+		if err := a.Exec("SELECT 1").Error; err == nil {
+			t.Errorf("expect idle database closed")
+		}
+		before := atomic.LoadInt32(&opened)
+		reopened, err := dbs.Get("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reopened.Exec("SELECT 1").Error; err != nil {
+			t.Errorf("expect reopened, got: %v", err)
+		}
+		if n := atomic.LoadInt32(&opened); n != before+1 {
+			t.Errorf("expect reopened once, got: %d", n-before)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		b, _ := dbs.Get("b")
+		err := dbs.Update(MultiOptions{
+			"b": {DBName: "b.db"},
+			"c": {DBName: "c.db"},
+		})
+		if err != nil {
+			t.Errorf("expect stale databases closed, got: %v", err)
+		}
+		if names := dbs.Names(); len(names) != 2 || names[0] != "b" || names[1] != "c" {
+			t.Errorf("unexpected names: %v", names)
+		}
+		if db, _ := dbs.Get("b"); db != b {
+			t.Errorf("expect unchanged database kept")
+		}
+		if _, err := dbs.Get("a"); !errors.Is(err, ErrDBNotConfigured) {
+			t.Errorf("expect removed, got: %v", err)
+		}
+		if _, err := dbs.Get("c"); err != nil {
+			t.Errorf("expect added, got: %v", err)
+		}
+		if err := dbs.Remove("c"); err != nil {
+			t.Errorf("expect closed, got: %v", err)
+		}
+		if _, err := dbs.Get("c"); !errors.Is(err, ErrDBNotConfigured) {
+			t.Errorf("expect removed, got: %v", err)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		if err := dbs.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dbs.Get("b"); !errors.Is(err, ErrLazyDBsClosed) {
+			t.Errorf("expect: %v, got: %v", ErrLazyDBsClosed, err)
+		}
+	})
+}
+
+func TestLazyDBs_OpenError(t *testing.T) {
+	var (
+		dials   int32
+		started = make(chan struct{}, 1)
+		release = make(chan struct{})
+	)
+	dial := func(opts *Options) (gorm.Dialector, error) {
+		atomic.AddInt32(&dials, 1)
+		started <- struct{}{}
+		<-release
+		return nil, errors.New("connection refused")
+	}
+	dbs := NewLazyDBs(MultiOptions{"a": {DBName: "a.db"}}, dial, nil, 0)
+	var gets int32
+	dbs.now = func() time.Time {
+		atomic.AddInt32(&gets, 1)
+		return time.Now()
+	}
+	defer dbs.Close(context.Background())
+
+	const waiters = 5
+	errs := make(chan error, waiters+1)
+	go func() {
+		_, err := dbs.Get("a")
+		errs <- err
+	}()
+	<-started
+	for i := 0; i < waiters; i++ {
+		go func() {
+			_, err := dbs.Get("a")
+			errs <- err
+		}()
+	}
+	// 全部访问进入等待后打开失败.
+	for atomic.LoadInt32(&gets) < waiters+1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < waiters+1; i++ {
+		if err := <-errs; err == nil {
+			t.Errorf("expect open error")
+		}
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Errorf("expect waiters share failed open, dials: %d", n)
+	}
+
+	// 下一次访问重新打开.
+	if _, err := dbs.Get("a"); err == nil {
+		t.Errorf("expect open error")
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("expect reopened on next access, dials: %d", n)
+	}
+}
+
+func TestLazyDBs_Close(t *testing.T) {
+	dir := t.TempDir()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	dial := func(opts *Options) (gorm.Dialector, error) {
+		started <- struct{}{}
+		<-release
+		return sqlite.Open(filepath.Join(dir, opts.DBName)), nil
+	}
+	dbs := NewLazyDBs(MultiOptions{"a": {DBName: "a.db"}}, dial, nil, 0)
+	opened := make(chan error, 1)
+	go func() {
+		_, err := dbs.Get("a")
+		opened <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := dbs.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect: %v, got: %v", context.DeadlineExceeded, err)
+	}
+	close(release)
+	// 关闭后打开完成的连接池被丢弃.
+	if err := <-opened; !errors.Is(err, ErrDBNotConfigured) {
+		t.Errorf("expect: %v, got: %v", ErrDBNotConfigured, err)
+	}
+
+	dbs = NewLazyDBs(MultiOptions{"b": {DBName: "b.db"}}, dial, nil, 0)
+	release = make(chan struct{})
+	go dbs.Get("b")
+	<-started
+	closed := make(chan error, 1)
+	go func() { closed <- dbs.Close(context.Background()) }()
+	select {
+	case err := <-closed:
+		t.Fatalf("expect close wait for opening, got: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Errorf("expect closed, got: %v", err)
+	}
+}
+
+func TestLazyDBs_RouteOpenError(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	dial := func(opts *Options) (gorm.Dialector, error) {
+		return nil, errRefused
+	}
+	source, dbs := MultiOptions{"a": {DBName: "a.db"}}.ToLazySource(dial, nil, testdb_router, 0)
+	defer dbs.Close(context.Background())
+	p := NewProvider(source)
+	ctx := testdb_new_context_with_dbname("a")
+
+	if err := p.UseDB(ctx).First(&TestDBModel{}, 1).Error; !errors.Is(err, errRefused) {
+		t.Errorf("expect: %v, got: %v", errRefused, err)
+	}
+	if err := p.UseWriteDB(ctx).Create(&TestDBModel{ID: 1}).Error; !errors.Is(err, errRefused) {
+		t.Errorf("expect: %v, got: %v", errRefused, err)
+	}
+	err := p.Transaction(ctx, func(ctx context.Context) error {
+		return nil
+	})
+	if !errors.Is(err, errRefused) {
+		t.Errorf("expect: %v, got: %v", errRefused, err)
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	if err := joinErrors(nil); err != nil {
+		t.Errorf("expect nil, got: %v", err)
+	}
+	err := joinErrors([]error{ErrDBNotConfigured, fmt.Errorf("close: %w", context.Canceled)})
+	if !errors.Is(err, ErrDBNotConfigured) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expect match joined errors, got: %v", err)
+	}
+	if err.Error() != "database not configured; close: context canceled" {
+		t.Errorf("unexpected message: %s", err)
+	}
+}
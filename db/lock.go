@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agztizoo/glue/lock"
+	"github.com/agztizoo/glue/timeservice"
+	"github.com/agztizoo/glue/transaction"
+)
+
+// LockTableName 分布式锁表名.
+var LockTableName = "glue_locks"
+
+// lockRecord 代表锁表中的一行.
+//
+// 释放锁时不删除行, 保证 fencing token 单调递增.
+type lockRecord struct {
+	Name      string `gorm:"primaryKey;size:191"`
+	Owner     string `gorm:"size:64"`
+	Token     int64
+	ExpiresAt time.Time
+}
+
+// LockProvider 定义锁使用的数据库与事务管理, *TransProvider 实现了该接口.
+type LockProvider interface {
+	Provider
+	transaction.Manager
+}
+
+// LockerOption 定义 Locker 配置项.
+type LockerOption func(*Locker)
+
+// WithLockRetry 设置获取锁失败时的重试间隔, 重试直到 ctx 结束.
+//
+// 默认不重试.
+func WithLockRetry(interval time.Duration) LockerOption {
+	return func(l *Locker) {
+		l.retry = interval
+	}
+}
+
+// WithLockTimeService 设置计算过期时间的时钟, 默认为系统时间.
+func WithLockTimeService(ts timeservice.TimeService) LockerOption {
+	return func(l *Locker) {
+		l.ts = ts
+	}
+}
+
+// Locker 实现基于数据库表的分布式锁, 用于没有 Redis 的环境.
+//
+// 每个 key 对应锁表中的一行, 记录持有者, fencing token 与过期时间.
+// 获取锁时更新已过期的行或插入新行, 成功时 token 递增.
+//
+// 锁操作逃脱当前事务, 始终在独立连接上执行, 事务回滚不影响锁的获取与释放.
+//
+// ⚠️ 注意: 过期时间由应用时钟计算, 各节点时钟偏差需远小于 ttl.
+//
+// 例:
+//	locker := db.NewLocker(provider, db.WithLockRetry(100*time.Millisecond))
+//	l, err := locker.Obtain(ctx, "order:1", 10*time.Second)
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Release(ctx)
+type Locker struct {
+	provider LockProvider
+	retry    time.Duration
+	ts       timeservice.TimeService
+}
+
+var _ lock.Locker = new(Locker)
+
+// NewLocker 创建 Locker.
+func NewLocker(p LockProvider, opts ...LockerOption) *Locker {
+	l := &Locker{provider: p, ts: timeservice.NewTimeService()}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// AutoMigrate 创建锁表.
+func (l *Locker) AutoMigrate(ctx context.Context) error {
+	return l.exec(ctx, func(db *gorm.DB) error {
+		return db.Migrator().AutoMigrate(&lockRecord{})
+	})
+}
+
+// Obtain 获取 key 对应的锁, 锁被占用时返回 lock.ErrNotObtained.
+//
+// 配置了重试间隔时重试, 直到 ctx 结束; ctx 结束时同样返回 lock.ErrNotObtained.
+func (l *Locker) Obtain(ctx context.Context, key string, ttl time.Duration) (lock.Lock, error) {
+	owner, err := newLockOwner()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, err := l.tryObtain(ctx, key, owner, ttl)
+		if err != nil && ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %v", lock.ErrNotObtained, ctx.Err())
+		}
+		if err != nil {
+			return nil, err
+		}
+		if token > 0 {
+			return &dbLock{locker: l, key: key, owner: owner, token: token}, nil
+		}
+		if l.retry <= 0 {
+			return nil, lock.ErrNotObtained
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %v", lock.ErrNotObtained, ctx.Err())
+		case <-time.After(l.retry):
+		}
+	}
+}
+
+// tryObtain 尝试获取锁, 返回 token, 未获取返回 0.
+func (l *Locker) tryObtain(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	var token int64
+	err := l.exec(ctx, func(db *gorm.DB) error {
+		now := l.ts.Now()
+		res := db.Where("name = ? AND expires_at <= ?", key, now).Updates(map[string]interface{}{
+			"owner":      owner,
+			"token":      gorm.Expr("token + 1"),
+			"expires_at": now.Add(ttl),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			r := &lockRecord{Name: key, Owner: owner, Token: 1, ExpiresAt: now.Add(ttl)}
+			res = db.Clauses(clause.OnConflict{DoNothing: true}).Create(r)
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		r := &lockRecord{}
+		if err := db.Where("name = ? AND owner = ?", key, owner).Take(r).Error; err != nil {
+			return err
+		}
+		token = r.Token
+		return nil
+	})
+	return token, err
+}
+
+// exec 逃脱当前事务, 在写库执行锁操作.
+func (l *Locker) exec(ctx context.Context, fn func(*gorm.DB) error) error {
+	return l.provider.EscapeTransaction(ctx, func(ctx context.Context) error {
+		db := l.provider.UseWriteDB(ctx).Table(LockTableName).Model(&lockRecord{})
+		return fn(db.Session(&gorm.Session{}))
+	})
+}
+
+func newLockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// dbLock 实现 lock.Lock.
+type dbLock struct {
+	locker *Locker
+	key    string
+	owner  string
+	token  int64
+}
+
+func (l *dbLock) Key() string {
+	return l.key
+}
+
+func (l *dbLock) Token() int64 {
+	return l.token
+}
+
+func (l *dbLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	now := l.locker.ts.Now()
+	return l.update(ctx, now, now.Add(ttl))
+}
+
+func (l *dbLock) Release(ctx context.Context) error {
+	now := l.locker.ts.Now()
+	return l.update(ctx, now, now)
+}
+
+// update 更新仍持有的锁的过期时间.
+func (l *dbLock) update(ctx context.Context, now, expiresAt time.Time) error {
+	return l.locker.exec(ctx, func(db *gorm.DB) error {
+		res := db.Where("name = ? AND owner = ? AND token = ? AND expires_at > ?", l.key, l.owner, l.token, now).
+			Update("expires_at", expiresAt)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return lock.ErrNotHeld
+		}
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agztizoo/glue/lock"
+)
+
+func TestLocker(t *testing.T) {
+	clock := &testAuditClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	p := testdb_newprovider(t, "lock")
+	ctx := context.Background()
+	locker := NewLocker(p, WithLockTimeService(clock))
+	if err := locker.AutoMigrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	l1, err := locker.Obtain(ctx, "key", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1.Key() != "key" || l1.Token() != 1 {
+		t.Errorf("unexpected lock: %s, %d", l1.Key(), l1.Token())
+	}
+	if _, err := locker.Obtain(ctx, "key", time.Minute); !errors.Is(err, lock.ErrNotObtained) {
+		t.Errorf("expect: %v, got: %v", lock.ErrNotObtained, err)
+	}
+	if _, err := locker.Obtain(ctx, "other", time.Minute); err != nil {
+		t.Errorf("expect other key obtained, got: %v", err)
+	}
+
+	t.Run("refresh", func(t *testing.T) {
+		clock.now = clock.now.Add(50 * time.Second)
+		if err := l1.Refresh(ctx, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		clock.now = clock.now.Add(50 * time.Second)
+		if _, err := locker.Obtain(ctx, "key", time.Minute); !errors.Is(err, lock.ErrNotObtained) {
+			t.Errorf("expect refreshed lock held, got: %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Minute)
+		l2, err := locker.Obtain(ctx, "key", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l2.Token() != 2 {
+			t.Errorf("expect fencing token increased, got: %d", l2.Token())
+		}
+		if err := l1.Release(ctx); !errors.Is(err, lock.ErrNotHeld) {
+			t.Errorf("expect: %v, got: %v", lock.ErrNotHeld, err)
+		}
+		if err := l1.Refresh(ctx, time.Minute); !errors.Is(err, lock.ErrNotHeld) {
+			t.Errorf("expect: %v, got: %v", lock.ErrNotHeld, err)
+		}
+		if err := l2.Release(ctx); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		var l3 lock.Lock
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			var err error
+			if l3, err = locker.Obtain(ctx, "key", time.Minute); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		if err == nil || err.Error() != "rollback" {
+			t.Fatalf("expect rollback error, got: %v", err)
+		}
+		// 事务回滚不影响锁.
+		if _, err := locker.Obtain(ctx, "key", time.Minute); !errors.Is(err, lock.ErrNotObtained) {
+			t.Errorf("expect lock held after rollback, got: %v", err)
+		}
+		if err := l3.Release(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		held, err := locker.Obtain(ctx, "retry", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		retrying := NewLocker(p, WithLockTimeService(clock), WithLockRetry(time.Millisecond))
+		cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := retrying.Obtain(cctx, "retry", time.Minute); !errors.Is(err, lock.ErrNotObtained) {
+			t.Errorf("expect: %v, got: %v", lock.ErrNotObtained, err)
+		}
+
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			_ = held.Release(ctx)
+		}()
+		cctx, cancel = context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if _, err := retrying.Obtain(cctx, "retry", time.Minute); err != nil {
+			t.Errorf("expect obtained after release, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultStatsInterval 默认连接池指标采集间隔.
+var DefaultStatsInterval = 15 * time.Second
+
+// StatsSink 定义连接池指标输出.
+type StatsSink interface {
+	// Publish 输出数据库连接池指标.
+	//
+	// name 为数据源中的数据库名.
+	Publish(name string, stats sql.DBStats)
+}
+
+// NewStatsCollector 创建数据源连接池指标采集器.
+//
+// ctxs 用于从数据源路由数据库, 每个 context 分别采集写库与读库,
+// 同名数据库只采集一次. 未指定时使用 context.Background().
+//
+// 例:
+//	sink := NewPrometheusSink("glue_db")
+//	collector := NewStatsCollector(source, sink, 0,
+//		tenantContext("tenant_a"), tenantContext("tenant_b"))
+//	go collector.Run(ctx)
+//	http.Handle("/metrics", sink)
+func NewStatsCollector(source Source, sink StatsSink, interval time.Duration, ctxs ...context.Context) *StatsCollector {
+	if interval <= 0 {
+		interval = DefaultStatsInterval
+	}
+	if len(ctxs) == 0 {
+		ctxs = []context.Context{context.Background()}
+	}
+	return &StatsCollector{
+		source:   source,
+		sink:     sink,
+		interval: interval,
+		ctxs:     ctxs,
+	}
+}
+
+// StatsCollector 实现数据源连接池指标定期采集.
+type StatsCollector struct {
+	source   Source
+	sink     StatsSink
+	interval time.Duration
+	ctxs     []context.Context
+}
+
+// Run 定期采集连接池指标, 直到 ctx 结束.
+func (c *StatsCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.Collect()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect 采集一次连接池指标.
+//
+// 读库与写库为同一连接池时只按写库名采集. 通过 dbresolver 注册的从库连接池
+// 不会被 Source 暴露, 读库指标只在读库为独立 *gorm.DB 时采集.
+func (c *StatsCollector) Collect() {
+	seen := make(map[string]bool)
+	pools := make(map[*sql.DB]bool)
+	for _, ctx := range c.ctxs {
+		c.collect(seen, pools, c.source.getWriteDBName(ctx), func() (*sql.DB, error) {
+			return c.source.getWriteDB(ctx).DB()
+		})
+		c.collect(seen, pools, c.source.getReadDBName(ctx), func() (*sql.DB, error) {
+			return c.source.getReadDB(ctx).DB()
+		})
+	}
+}
+
+func (c *StatsCollector) collect(seen map[string]bool, pools map[*sql.DB]bool, name string, sqlDB func() (*sql.DB, error)) {
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+
+	defer func() {
+		// 数据源未匹配到数据库.
+		if err := recover(); err != nil {
+			logrus.Warnf("[glue][db] failed to collect stats of database: %s, panic: %v", name, err)
+		}
+	}()
+	d, err := sqlDB()
+	if err != nil {
+		logrus.Warnf("[glue][db] failed to collect stats of database: %s, error: %v", name, err)
+		return
+	}
+	// 已按其他库名采集的连接池, 如 dbresolver 读库返回的主库连接池.
+	if pools[d] {
+		return
+	}
+	pools[d] = true
+	c.sink.Publish(name, d.Stats())
+}
+
+// NewMemorySink 创建内存指标输出, 用于测试.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{stats: make(map[string]sql.DBStats)}
+}
+
+// MemorySink 在内存中保存各数据库最近一次连接池指标.
+type MemorySink struct {
+	mut   sync.RWMutex
+	stats map[string]sql.DBStats
+}
+
+// Publish 输出数据库连接池指标.
+func (s *MemorySink) Publish(name string, stats sql.DBStats) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.stats[name] = stats
+}
+
+// Get 获取数据库最近一次连接池指标.
+func (s *MemorySink) Get(name string) (sql.DBStats, bool) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	stats, ok := s.stats[name]
+	return stats, ok
+}
+
+// Names 返回已采集的数据库名.
+func (s *MemorySink) Names() []string {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	names := make([]string, 0, len(s.stats))
+	for name := range s.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPrometheusSink 创建 Prometheus 文本格式指标输出.
+//
+// namespace 为指标名前缀, 为空时使用 glue_db.
+func NewPrometheusSink(namespace string) *PrometheusSink {
+	if namespace == "" {
+		namespace = "glue_db"
+	}
+	return &PrometheusSink{namespace: namespace, mem: NewMemorySink()}
+}
+
+// PrometheusSink 实现 Prometheus 文本格式指标输出.
+//
+// 实现了 http.Handler, 可直接挂载为 /metrics.
+type PrometheusSink struct {
+	namespace string
+	mem       *MemorySink
+}
+
+var _ http.Handler = new(PrometheusSink)
+
+// Publish 输出数据库连接池指标.
+func (s *PrometheusSink) Publish(name string, stats sql.DBStats) {
+	s.mem.Publish(name, stats)
+}
+
+// ServeHTTP 输出 Prometheus 文本格式指标.
+func (s *PrometheusSink) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.WriteTo(w)
+}
+
+// prometheusMetric 定义导出的连接池指标.
+type prometheusMetric struct {
+	name  string
+	typ   string
+	help  string
+	value func(sql.DBStats) float64
+}
+
+var prometheusMetrics = []prometheusMetric{
+	{"max_open_connections", "gauge", "Maximum number of open connections to the database.",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+	{"open_connections", "gauge", "The number of established connections both in use and idle.",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+	{"in_use", "gauge", "The number of connections currently in use.",
+		func(s sql.DBStats) float64 { return float64(s.InUse) }},
+	{"idle", "gauge", "The number of idle connections.",
+		func(s sql.DBStats) float64 { return float64(s.Idle) }},
+	{"wait_count_total", "counter", "The total number of connections waited for.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+	{"wait_duration_seconds_total", "counter", "The total time blocked waiting for a new connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+	{"max_idle_closed_total", "counter", "The total number of connections closed due to SetMaxIdleConns.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+	{"max_idle_time_closed_total", "counter", "The total number of connections closed due to SetConnMaxIdleTime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+	{"max_lifetime_closed_total", "counter", "The total number of connections closed due to SetConnMaxLifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+}
+
+// WriteTo 写出 Prometheus 文本格式指标.
+func (s *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	names := s.mem.Names()
+	var b strings.Builder
+	for _, m := range prometheusMetrics {
+		metric := fmt.Sprintf("%s_%s", s.namespace, m.name)
+		fmt.Fprintf(&b, "# HELP %s %s\n", metric, m.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", metric, m.typ)
+		for _, name := range names {
+			stats, _ := s.mem.Get(name)
+			fmt.Fprintf(&b, "%s{db=%q} %v\n", metric, name, m.value(stats))
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
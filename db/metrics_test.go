@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsCollector_Collect(t *testing.T) {
+	source := testdb_newsource(t, "stats_a", "stats_b")
+	sink := NewMemorySink()
+	collector := NewStatsCollector(source, sink, 0,
+		testdb_new_context_with_dbname("stats_a"),
+		testdb_new_context_with_dbname("stats_b"),
+		testdb_new_context_with_dbname("stats_not_exists"),
+	)
+	collector.Collect()
+
+	names := sink.Names()
+	if strings.Join(names, ",") != "stats_a,stats_b" {
+		t.Errorf("expect: stats_a,stats_b, got: %v", names)
+	}
+	stats, ok := sink.Get("stats_a")
+	if !ok {
+		t.Fatal("expect stats_a collected")
+	}
+	if stats.OpenConnections < 1 {
+		t.Errorf("expect open connections, got: %d", stats.OpenConnections)
+	}
+}
+
+func TestStatsCollector_Collect_SharedPool(t *testing.T) {
+	opts := &RWOptions{
+		Write: &Options{DBName: "stats_rw_write"},
+		Read:  &Options{DBName: "stats_rw_read"},
+	}
+	db, err := opts.OpenDB(testdb_dial(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 读库为 dbresolver 路由的同一个 *gorm.DB, 连接池为主库连接池.
+	source := NewWriteReadSource("stats_rw_write", db, "stats_rw_read", db)
+	sink := NewMemorySink()
+	NewStatsCollector(source, sink, 0).Collect()
+
+	if names := sink.Names(); strings.Join(names, ",") != "stats_rw_write" {
+		t.Errorf("expect: stats_rw_write, got: %v", names)
+	}
+}
+
+func TestStatsCollector_Run(t *testing.T) {
+	source := testdb_newsource(t, "stats_run")
+	sink := NewMemorySink()
+	collector := NewStatsCollector(source, sink, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	collector.Run(ctx)
+
+	if _, ok := sink.Get("stats_run"); !ok {
+		t.Error("expect stats_run collected")
+	}
+}
+
+func TestPrometheusSink(t *testing.T) {
+	source := testdb_newsource(t, "stats_prom")
+	sink := NewPrometheusSink("")
+	NewStatsCollector(source, sink, 0).Collect()
+
+	rec := httptest.NewRecorder()
+	sink.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, expect := range []string{
+		"# TYPE glue_db_open_connections gauge\n",
+		"# TYPE glue_db_wait_count_total counter\n",
+		`glue_db_in_use{db="stats_prom"} 0`,
+		`glue_db_wait_duration_seconds_total{db="stats_prom"} 0`,
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("expect contains: %s, got: %s", expect, body)
+		}
+	}
+}
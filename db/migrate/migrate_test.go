@@ -0,0 +1,271 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/db"
+	"github.com/agztizoo/glue/lock"
+)
+
+func testDial(dir string) db.Dialector {
+	return func(opts *db.Options) (gorm.Dialector, error) {
+		return sqlite.Open(filepath.Join(dir, opts.DBName)), nil
+	}
+}
+
+func testProvider(t *testing.T, dir string) *db.TransProvider {
+	opts := &db.Options{DBName: "migrate.db"}
+	source, err := opts.ToSource(testDial(dir), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db.NewProvider(source)
+}
+
+func testWriteFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testTables(t *testing.T, p *db.TransProvider) []string {
+	tables, err := p.UseDB(context.Background()).Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tables
+}
+
+func TestMigrator(t *testing.T) {
+	dir := t.TempDir()
+	testWriteFiles(t, dir, map[string]string{
+		"0001_create_users.up.sql": `
+-- 用户表
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	name TEXT
+);
+CREATE INDEX idx_users_name ON users (name);
+`,
+		"0001_create_users.down.sql":  "DROP TABLE users;",
+		"0002_create_orders.up.sql":   "CREATE TABLE orders (id INTEGER PRIMARY KEY);",
+		"0002_create_orders.down.sql": "DROP TABLE orders;",
+		"0003_seed.up.sql":            "INSERT INTO users (id, name) VALUES (1, 'alice');",
+		"README.md":                   "ignored",
+	})
+	ms, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 3 || ms[0].Name != "create_users" || ms[2].Reversible() {
+		t.Fatalf("unexpected migrations: %v", ms)
+	}
+
+	p := testProvider(t, dir)
+	ctx := context.Background()
+
+	t.Run("dry run", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		done, err := New(p, ms, WithDryRun(), WithOutput(out)).Up(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(done) != 3 || !strings.Contains(out.String(), "CREATE INDEX idx_users_name") {
+			t.Errorf("unexpected dry run: %d, %s", len(done), out)
+		}
+		if _, err := New(p, ms).Status(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := New(p, ms).Verify(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if tables := testTables(t, p); len(tables) != 0 {
+			t.Errorf("expect no table created in dry run, status and verify, got: %v", tables)
+		}
+	})
+
+	t.Run("up", func(t *testing.T) {
+		done, err := New(p, ms).Up(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(done) != 2 {
+			t.Errorf("expect 2 migrations applied, got: %d", len(done))
+		}
+		done, err = New(p, ms).Up(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(done) != 1 || done[0].Version != 3 {
+			t.Errorf("unexpected migrations applied: %v", done)
+		}
+		if !p.UseDB(ctx).Migrator().HasTable(TableName) {
+			t.Errorf("expect table: %s", TableName)
+		}
+		status, err := New(p, ms).Status(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range status {
+			if s.Record == nil || s.Record.Checksum != s.Checksum() {
+				t.Errorf("unexpected status: %v, %+v", s.Migration, s.Record)
+			}
+		}
+	})
+
+	t.Run("down", func(t *testing.T) {
+		if _, err := New(p, ms).Down(ctx, 1); !errors.Is(err, ErrIrreversible) {
+			t.Errorf("expect: %v, got: %v", ErrIrreversible, err)
+		}
+		// 跳过不可回滚的迁移.
+		reversible := ms[:2]
+		p.UseWriteDB(ctx).Table(TableName).Delete(&Record{Version: 3})
+		done, err := New(p, reversible).Down(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(done) != 1 || done[0].Version != 2 {
+			t.Errorf("unexpected migrations reverted: %v", done)
+		}
+		for _, table := range testTables(t, p) {
+			if table == "orders" {
+				t.Errorf("expect orders dropped")
+			}
+		}
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		changed := *ms[0]
+		changed.UpSQL += "\n-- changed"
+		err := New(p, []*Migration{&changed, ms[1]}).Verify(ctx)
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("expect: %v, got: %v", ErrChecksumMismatch, err)
+		}
+		if _, err := New(p, ms[1:2]).Up(ctx, 0); !errors.Is(err, ErrMissingMigration) {
+			t.Errorf("expect: %v, got: %v", ErrMissingMigration, err)
+		}
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		broken := &Migration{Version: 4, Name: "broken", UpSQL: "CREATE TABLE broken (id INTEGER);\nINSERT INTO missing VALUES (1);"}
+		if _, err := New(p, append(ms[:2:2], broken)).Up(ctx, 0); err == nil {
+			t.Fatal("expect error")
+		}
+		for _, table := range testTables(t, p) {
+			if table == "broken" {
+				t.Errorf("expect broken rolled back")
+			}
+		}
+		status, _ := New(p, ms[:2]).Status(ctx)
+		if status[1].Record == nil {
+			t.Errorf("expect migrations before broken applied")
+		}
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `
+CREATE TABLE users (id INTEGER PRIMARY KEY, version INTEGER);
+-- +migrate StatementBegin
+CREATE TRIGGER users_updated AFTER UPDATE OF id ON users
+BEGIN
+	UPDATE users SET version = version + 1 WHERE id = NEW.id;
+	UPDATE users SET version = version + 1 WHERE id = OLD.id;
+END;
+-- +migrate StatementEnd
+INSERT INTO users (id, version) VALUES (1, 0);
+`
+	stmts := splitStatements(sql)
+	if len(stmts) != 3 || !strings.HasPrefix(stmts[1], "CREATE TRIGGER") || !strings.HasSuffix(stmts[1], "END;") {
+		t.Fatalf("unexpected statements: %q", stmts)
+	}
+
+	p := testProvider(t, t.TempDir())
+	m := &Migration{Version: 1, Name: "trigger", UpSQL: sql}
+	if _, err := New(p, []*Migration{m}).Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigratorLock(t *testing.T) {
+	p := testProvider(t, t.TempDir())
+	ctx := context.Background()
+	locker := db.NewLocker(p)
+	if err := locker.AutoMigrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l, err := locker.Obtain(ctx, "glue:migrate:"+TableName, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Migration{Version: 1, Name: "users", UpSQL: "CREATE TABLE users (id INTEGER);"}
+	if _, err := New(p, []*Migration{m}, WithLocker(locker)).Up(ctx, 0); !errors.Is(err, lock.ErrNotObtained) {
+		t.Errorf("expect: %v, got: %v", lock.ErrNotObtained, err)
+	}
+	if p.UseDB(ctx).Migrator().HasTable("users") {
+		t.Error("expect users not created without lock")
+	}
+
+	// 锁释放后可以执行.
+	if err := l.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(p, []*Migration{m}, WithLocker(locker)).Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !p.UseDB(ctx).Migrator().HasTable("users") {
+		t.Error("expect users created")
+	}
+}
+
+func TestGoMigration(t *testing.T) {
+	dir := t.TempDir()
+	up := func(ctx context.Context, tx *gorm.DB) error {
+		return tx.Exec("CREATE TABLE go_users (id INTEGER)").Error
+	}
+	m := &Migration{Version: 1, Name: "go_users", Up: up}
+	if m.Checksum() != "" || m.Reversible() {
+		t.Errorf("unexpected go migration: %s, %v", m.Checksum(), m.Reversible())
+	}
+
+	opts := db.MultiRWOptions{
+		"a": {Write: &db.Options{DBName: "a.db"}},
+		"b": {Write: &db.Options{DBName: "b.db"}},
+	}
+	var names []string
+	err := RunAll(opts, testDial(dir), nil, func(name string, p *db.TransProvider) error {
+		names = append(names, name)
+		_, err := New(p, []*Migration{m}).Up(context.Background(), 0)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "a,b" {
+		t.Errorf("unexpected databases: %v", names)
+	}
+	for _, name := range []string{"a.db", "b.db"} {
+		gdb, err := gorm.Open(sqlite.Open(filepath.Join(dir, name)), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !gdb.Migrator().HasTable("go_users") {
+			t.Errorf("expect go_users created in %s", name)
+		}
+		if sqlDB, err := gdb.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/env"
+)
+
+var (
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	ErrMissingUp        = errors.New("migration up not found")
+)
+
+// SQL 迁移文件名格式: {version}_{name}.up.sql, {version}_{name}.down.sql.
+//
+// 例: 0001_create_users.up.sql
+var sqlFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Func 定义 Go 迁移函数, db 为迁移所在事务或连接.
+type Func func(ctx context.Context, db *gorm.DB) error
+
+// Migration 代表一个版本的迁移.
+//
+// SQL 迁移与 Go 迁移二选一.
+type Migration struct {
+	Version int64
+	Name    string
+
+	// SQL 迁移语句, 以行尾 ';' 分隔多条语句, -- +migrate StatementBegin/StatementEnd 之间不拆分.
+	UpSQL   string
+	DownSQL string
+
+	// Go 迁移函数.
+	Up   Func
+	Down Func
+}
+
+// Checksum 返回 SQL 迁移的校验和, Go 迁移返回空字符串.
+func (m *Migration) Checksum() string {
+	if m.UpSQL == "" && m.DownSQL == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpSQL + "\x00" + m.DownSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+// Reversible 返回是否可回滚.
+func (m *Migration) Reversible() bool {
+	return m.DownSQL != "" || m.Down != nil
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[int64]*Migration)
+)
+
+// Register 注册 Go 迁移, 通常在 init 中调用.
+//
+// 版本重复时 panic.
+func Register(version int64, name string, up, down Func) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[version]; ok {
+		panic(fmt.Errorf("%w: %d", ErrDuplicateVersion, version))
+	}
+	registry[version] = &Migration{Version: version, Name: name, Up: up, Down: down}
+}
+
+// Load 加载目录中的 SQL 迁移与已注册的 Go 迁移, 按版本升序返回.
+//
+// 相对路径基于 env.WorkDir(), dir 为空时只返回 Go 迁移.
+func Load(dir string) ([]*Migration, error) {
+	ms := make(map[int64]*Migration)
+	registryMu.Lock()
+	for v, m := range registry {
+		ms[v] = m
+	}
+	registryMu.Unlock()
+
+	if dir != "" {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(env.WorkDir(), dir)
+		}
+		if err := loadSQL(dir, ms); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*Migration, 0, len(ms))
+	for _, m := range ms {
+		if m.UpSQL == "" && m.Up == nil {
+			return nil, fmt.Errorf("%w: %s", ErrMissingUp, m)
+		}
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+func loadSQL(dir string, ms map[int64]*Migration) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		matches := sqlFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		m, ok := ms[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			ms[version] = m
+		}
+		if m.Name != matches[2] || m.Up != nil || m.Down != nil {
+			return fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+		}
+		if matches[3] == "up" {
+			m.UpSQL = string(content)
+		} else {
+			m.DownSQL = string(content)
+		}
+	}
+	return nil
+}
+
+// 语句块标记, 标记之间的内容作为一条语句执行, 用于包含 ';' 的存储过程, 触发器等.
+//
+// 例:
+//	-- +migrate StatementBegin
+//	CREATE TRIGGER users_updated AFTER UPDATE ON users
+//	BEGIN
+//		UPDATE users SET version = version + 1 WHERE id = NEW.id;
+//	END;
+//	-- +migrate StatementEnd
+const (
+	statementBegin = "-- +migrate StatementBegin"
+	statementEnd   = "-- +migrate StatementEnd"
+)
+
+// splitStatements 按行尾 ';' 拆分语句, 忽略空语句与注释行.
+//
+// 语句块标记之间的内容不拆分.
+func splitStatements(sql string) []string {
+	var (
+		stmts   []string
+		buf     strings.Builder
+		inBlock bool
+	)
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		buf.Reset()
+	}
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch trimmed {
+		case statementBegin:
+			flush()
+			inBlock = true
+			continue
+		case statementEnd:
+			flush()
+			inBlock = false
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+	return stmts
+}
@@ -0,0 +1,362 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/db"
+	"github.com/agztizoo/glue/lock"
+	"github.com/agztizoo/glue/transaction"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrMissingMigration = errors.New("applied migration not found")
+	ErrIrreversible     = errors.New("migration is irreversible")
+)
+
+var (
+	// TableName 已执行迁移记录表名.
+	TableName = "schema_migrations"
+
+	// TransactionalDDL 支持在事务中执行 DDL 的方言.
+	//
+	// 其他方言(如 mysql 隐式提交 DDL)逐条执行语句, 执行成功后记录版本.
+	TransactionalDDL = map[string]bool{
+		"sqlite":    true,
+		"postgres":  true,
+		"sqlserver": true,
+	}
+
+	// LockTTL 迁移锁过期时间, 每个迁移执行完成后续期.
+	LockTTL = 10 * time.Minute
+	// LockRetry 默认迁移锁被占用时的重试间隔.
+	LockRetry = time.Second
+)
+
+// Provider 定义迁移使用的数据库与事务管理, *db.TransProvider 实现了该接口.
+type Provider interface {
+	db.Provider
+	transaction.Manager
+}
+
+// Record 代表已执行的迁移记录.
+type Record struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Status 代表迁移状态.
+type Status struct {
+	*Migration
+	// 未执行时为 nil.
+	Record *Record
+}
+
+// Option 定义 Migrator 配置项.
+type Option func(*Migrator)
+
+// WithDryRun 只输出待执行的迁移与语句, 不执行.
+func WithDryRun() Option {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+// WithOutput 设置执行过程输出, 默认不输出.
+func WithOutput(w io.Writer) Option {
+	return func(m *Migrator) {
+		m.out = w
+	}
+}
+
+// WithLocker 设置 Up, Down 使用的迁移锁.
+//
+// 默认使用 db.Locker, 在迁移数据库中创建锁表 db.LockTableName.
+func WithLocker(l lock.Locker) Option {
+	return func(m *Migrator) {
+		m.locker = l
+	}
+}
+
+// Migrator 实现数据库迁移.
+//
+// 执行前校验已执行迁移的校验和, SQL 被修改时报错 ErrChecksumMismatch.
+// 方言支持事务 DDL 时, 每个迁移与版本记录在同一 transaction.Manager 事务中执行.
+//
+// Up, Down 持有迁移锁, 多个实例同时部署时依次执行; 锁被占用时等待, 直到 ctx 结束.
+// Status, Verify 与 dry-run 不创建迁移记录表与锁表.
+type Migrator struct {
+	provider   Provider
+	migrations []*Migration
+	dryRun     bool
+	out        io.Writer
+	now        func() time.Time
+	locker     lock.Locker
+}
+
+// New 创建 Migrator, migrations 通常由 Load 加载.
+func New(p Provider, migrations []*Migration, opts ...Option) *Migrator {
+	m := &Migrator{provider: p, migrations: migrations, out: io.Discard, now: time.Now}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Status 返回全部迁移状态, 按版本升序.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	records, err := m.records(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		result = append(result, &Status{Migration: mg, Record: records[mg.Version]})
+	}
+	return result, nil
+}
+
+// Verify 校验已执行迁移, 记录不存在于迁移列表时报错 ErrMissingMigration,
+// SQL 迁移校验和不一致时报错 ErrChecksumMismatch.
+func (m *Migrator) Verify(ctx context.Context) error {
+	records, err := m.records(ctx, false)
+	if err != nil {
+		return err
+	}
+	return m.verify(records)
+}
+
+// Up 按版本升序执行未执行的迁移, target 大于 0 时只执行到 target 版本.
+//
+// 返回执行(或 dry-run 时待执行)的迁移.
+func (m *Migrator) Up(ctx context.Context, target int64) (done []*Migration, err error) {
+	l, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(ctx, l, &err)
+
+	records, err := m.records(ctx, !m.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(records); err != nil {
+		return nil, err
+	}
+	for _, mg := range m.migrations {
+		if target > 0 && mg.Version > target {
+			break
+		}
+		if _, ok := records[mg.Version]; ok {
+			continue
+		}
+		if err := m.apply(ctx, l, mg, true); err != nil {
+			return done, err
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Down 按版本降序回滚最近执行的 steps 个迁移.
+//
+// 返回回滚(或 dry-run 时待回滚)的迁移.
+func (m *Migrator) Down(ctx context.Context, steps int) (done []*Migration, err error) {
+	l, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(ctx, l, &err)
+
+	records, err := m.records(ctx, !m.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(records); err != nil {
+		return nil, err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mg := m.migrations[i]
+		if _, ok := records[mg.Version]; !ok {
+			continue
+		}
+		if !mg.Reversible() {
+			return done, fmt.Errorf("%w: %s", ErrIrreversible, mg)
+		}
+		if err := m.apply(ctx, l, mg, false); err != nil {
+			return done, err
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// lock 获取迁移锁, dry-run 时不加锁返回 nil.
+func (m *Migrator) lock(ctx context.Context) (lock.Lock, error) {
+	if m.dryRun {
+		return nil, nil
+	}
+	locker := m.locker
+	if locker == nil {
+		dl := db.NewLocker(m.provider, db.WithLockRetry(LockRetry))
+		if err := dl.AutoMigrate(ctx); err != nil {
+			return nil, err
+		}
+		locker = dl
+	}
+	l, err := locker.Obtain(ctx, "glue:migrate:"+TableName, LockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("obtain migration lock: %w", err)
+	}
+	return l, nil
+}
+
+// unlock 释放迁移锁, 释放失败且迁移成功时返回释放错误.
+func (m *Migrator) unlock(ctx context.Context, l lock.Lock, err *error) {
+	if l == nil {
+		return
+	}
+	if e := l.Release(ctx); e != nil && *err == nil {
+		*err = fmt.Errorf("release migration lock: %w", e)
+	}
+}
+
+// records 返回已执行迁移记录.
+//
+// create 为 false 时不创建记录表, 记录表不存在视为没有记录.
+func (m *Migrator) records(ctx context.Context, create bool) (map[int64]*Record, error) {
+	tx := m.provider.UseWriteDB(ctx)
+	if !create && !tx.Migrator().HasTable(TableName) {
+		return map[int64]*Record{}, nil
+	}
+	if create {
+		if err := m.table(tx).Migrator().AutoMigrate(&Record{}); err != nil {
+			return nil, err
+		}
+	}
+	var rs []*Record
+	if err := m.table(m.provider.UseWriteDB(ctx)).Find(&rs).Error; err != nil {
+		return nil, err
+	}
+	records := make(map[int64]*Record, len(rs))
+	for _, r := range rs {
+		records[r.Version] = r
+	}
+	return records, nil
+}
+
+func (m *Migrator) verify(records map[int64]*Record) error {
+	known := make(map[int64]*Migration, len(m.migrations))
+	for _, mg := range m.migrations {
+		known[mg.Version] = mg
+	}
+	versions := make([]int64, 0, len(records))
+	for v := range records {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, v := range versions {
+		r := records[v]
+		mg, ok := known[v]
+		if !ok {
+			return fmt.Errorf("%w: %d_%s", ErrMissingMigration, r.Version, r.Name)
+		}
+		if sum := mg.Checksum(); sum != r.Checksum {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, mg)
+		}
+	}
+	return nil
+}
+
+// apply 执行迁移并更新版本记录, 执行完成后续期迁移锁.
+func (m *Migrator) apply(ctx context.Context, l lock.Lock, mg *Migration, up bool) error {
+	sql, fn, direction := mg.UpSQL, mg.Up, "up"
+	if !up {
+		sql, fn, direction = mg.DownSQL, mg.Down, "down"
+	}
+	fmt.Fprintf(m.out, "-- %s %s\n", direction, mg)
+	if m.dryRun {
+		for _, stmt := range splitStatements(sql) {
+			fmt.Fprintln(m.out, stmt)
+		}
+		return nil
+	}
+
+	run := func(ctx context.Context) error {
+		tx := m.provider.UseWriteDB(ctx)
+		if fn != nil {
+			if err := fn(ctx, tx); err != nil {
+				return err
+			}
+		}
+		for _, stmt := range splitStatements(sql) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("%s: %w", mg, err)
+			}
+		}
+		if up {
+			r := &Record{Version: mg.Version, Name: mg.Name, Checksum: mg.Checksum(), AppliedAt: m.now()}
+			return m.table(m.provider.UseWriteDB(ctx)).Create(r).Error
+		}
+		return m.table(m.provider.UseWriteDB(ctx)).Delete(&Record{Version: mg.Version}).Error
+	}
+	var err error
+	if TransactionalDDL[m.provider.UseWriteDB(ctx).Dialector.Name()] {
+		err = m.provider.Transaction(ctx, run)
+	} else {
+		err = run(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return l.Refresh(ctx, LockTTL)
+}
+
+func (m *Migrator) table(tx *gorm.DB) *gorm.DB {
+	return tx.Table(TableName)
+}
+
+// RunAll 对 MultiRWOptions 中的每个数据库执行 fn, 按名称升序, 遇错停止.
+//
+// 例:
+//	err := migrate.RunAll(opts, mysql.Dialector, nil, func(name string, p *db.TransProvider) error {
+//		_, err := migrate.New(p, migrations).Up(ctx, 0)
+//		return err
+//	})
+func RunAll(opts db.MultiRWOptions, dial db.Dialector, config *gorm.Config, fn func(name string, p *db.TransProvider) error) error {
+	names := make([]string, 0, len(opts))
+	for name, opt := range opts {
+		if opt != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := runOne(name, opts[name], dial, config, fn); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func runOne(name string, opt *db.RWOptions, dial db.Dialector, config *gorm.Config, fn func(string, *db.TransProvider) error) error {
+	gdb, err := opt.OpenDB(dial, config)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	return fn(name, db.NewProvider(db.NewSource(name, gdb)))
+}
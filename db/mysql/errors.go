@@ -0,0 +1,74 @@
+package mysql
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+
+	"github.com/agztizoo/glue/db"
+)
+
+// MySQL 错误码.
+//
+// https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	erDupEntry              = 1062
+	erDupEntryWithKeyName   = 1586
+	erNoReferencedRow       = 1216
+	erRowIsReferenced       = 1217
+	erRowIsReferenced2      = 1451
+	erNoReferencedRow2      = 1452
+	erLockWaitTimeout       = 1205
+	erLockDeadlock          = 1213
+	erLockNowait            = 3572
+	erConCount              = 1040
+	erServerShutdown        = 1053
+	erClientInteractionTime = 4031
+)
+
+var (
+	dupKeyName     = regexp.MustCompile(`for key '([^']+)'`)
+	constraintName = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+)
+
+// TranslateError 分类 MySQL 驱动错误, 用于 db.ErrorTranslateHook.
+func TranslateError(err error) *db.Error {
+	if errors.Is(err, mysqldriver.ErrInvalidConn) {
+		return &db.Error{Kind: db.ErrConnection, Err: err}
+	}
+	var me *mysqldriver.MySQLError
+	if !errors.As(err, &me) {
+		return nil
+	}
+	switch me.Number {
+	case erDupEntry, erDupEntryWithKeyName:
+		return &db.Error{Kind: db.ErrDuplicateKey, Constraint: duplicateKeyName(me.Message), Err: err}
+	case erNoReferencedRow, erRowIsReferenced, erRowIsReferenced2, erNoReferencedRow2:
+		return &db.Error{Kind: db.ErrForeignKeyViolation, Constraint: submatch(constraintName, me.Message), Err: err}
+	case erLockDeadlock:
+		return &db.Error{Kind: db.ErrDeadlock, Err: err}
+	case erLockWaitTimeout, erLockNowait:
+		return &db.Error{Kind: db.ErrLockTimeout, Err: err}
+	case erConCount, erServerShutdown, erClientInteractionTime:
+		return &db.Error{Kind: db.ErrConnection, Err: err}
+	}
+	return nil
+}
+
+// duplicateKeyName 返回唯一索引名, MySQL 8 返回 表名.索引名, 去除表名.
+func duplicateKeyName(msg string) string {
+	name := submatch(dupKeyName, msg)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+func submatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); len(m) > 1 {
+		return m[1]
+	}
+	return ""
+}
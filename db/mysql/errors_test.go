@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+
+	"github.com/agztizoo/glue/db"
+)
+
+func TestTranslateError(t *testing.T) {
+	cases := []struct {
+		give       error
+		kind       error
+		constraint string
+	}{
+		{
+			give:       &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'users.idx_email'"},
+			kind:       db.ErrDuplicateKey,
+			constraint: "idx_email",
+		},
+		{
+			give:       &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'PRIMARY'"},
+			kind:       db.ErrDuplicateKey,
+			constraint: "PRIMARY",
+		},
+		{
+			give: &mysqldriver.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+				"(`test`.`orders`, CONSTRAINT `fk_orders_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"},
+			kind:       db.ErrForeignKeyViolation,
+			constraint: "fk_orders_user",
+		},
+		{
+			give: &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"},
+			kind: db.ErrDeadlock,
+		},
+		{
+			give: fmt.Errorf("update: %w", &mysqldriver.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}),
+			kind: db.ErrLockTimeout,
+		},
+		{
+			give: mysqldriver.ErrInvalidConn,
+			kind: db.ErrConnection,
+		},
+		{
+			give: &mysqldriver.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"},
+		},
+	}
+	for _, c := range cases {
+		e := TranslateError(c.give)
+		if c.kind == nil {
+			if e != nil {
+				t.Errorf("%v: expect untranslated, got: %v", c.give, e.Kind)
+			}
+			continue
+		}
+		if e == nil || !errors.Is(e, c.kind) || e.Constraint != c.constraint || !errors.Is(e, c.give) {
+			t.Errorf("%v: expect: %v %s, got: %+v", c.give, c.kind, c.constraint, e)
+		}
+	}
+}
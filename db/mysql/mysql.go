@@ -21,13 +21,24 @@ var (
 
 	// https://github.com/go-sql-driver/mysql#important-settings
 	ConnMaxLifeTime = db.DefaultConnMaxLifeTime
+	ConnMaxIdleTime = db.DefaultConnMaxIdleTime
 )
 
 // Dialector 定义字节数据库配置与方言转换函数.
+//
+// 默认安装 db.ErrorTranslateHook, 驱动错误包装为 *db.Error,
+// 使用 errors.As 获取 *mysql.MySQLError.
 func Dialector(opts *db.Options) (gorm.Dialector, error) {
-	hs := make([]func(*gorm.DB) error, 0, 2)
+	hs := make([]func(*gorm.DB) error, 0, 3)
 	// 连接池配置 Hook.
-	hs = append(hs, db.ConnPoolHook(int(opts.MaxIdleConns), int(opts.MaxOpenConns), ConnMaxLifeTime))
+	hs = append(hs, db.ConnPoolHookWithIdleTime(int(opts.MaxIdleConns), int(opts.MaxOpenConns),
+		getConnMaxLifeTime(opts), getConnMaxIdleTime(opts)))
+	// 语句默认超时 Hook.
+	if opts.StatementTimeout != nil {
+		hs = append(hs, db.StatementTimeoutHook(opts.StatementTimeout))
+	}
+	// 错误分类 Hook.
+	hs = append(hs, db.ErrorTranslateHook(TranslateError))
 
 	dial := db.WithInitializeHook(dialector, hs...)
 	return dial(opts)
@@ -66,3 +77,17 @@ func getWriteTimeout(opts *db.Options) time.Duration {
 	}
 	return DefaultWriteTimeout
 }
+
+func getConnMaxLifeTime(opts *db.Options) time.Duration {
+	if lt := opts.ConnMaxLifetime(); lt > 0 {
+		return lt
+	}
+	return ConnMaxLifeTime
+}
+
+func getConnMaxIdleTime(opts *db.Options) time.Duration {
+	if it := opts.ConnMaxIdleTime(); it > 0 {
+		return it
+	}
+	return ConnMaxIdleTime
+}
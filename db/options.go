@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/plugin/dbresolver"
@@ -52,6 +53,13 @@ type Options struct {
 	// 连接池配置项.
 	MaxIdleConns uint `yaml:"max_idle_conns"`
 	MaxOpenConns uint `yaml:"max_open_conns"`
+
+	// 连接生命周期配置项.
+	ConnMaxLifetimeInMills uint `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTimeInMills uint `yaml:"conn_max_idle_time"`
+
+	// 语句默认超时配置项.
+	StatementTimeout *StatementTimeoutOptions `yaml:"statement_timeout"`
 }
 
 // OpenDBs 创建数据库连接列表.
@@ -143,7 +151,30 @@ func (o *RWOptions) ToSource(dial Dialector, config *gorm.Config) (Source, error
 	return NewSource(name, db), nil
 }
 
+// ConnMaxLifetime 返回连接最大生命周期, 未配置返回 0.
+func (o *Options) ConnMaxLifetime() time.Duration {
+	return time.Duration(o.ConnMaxLifetimeInMills) * time.Millisecond
+}
+
+// ConnMaxIdleTime 返回连接最大空闲时间, 未配置返回 0.
+func (o *Options) ConnMaxIdleTime() time.Duration {
+	return time.Duration(o.ConnMaxIdleTimeInMills) * time.Millisecond
+}
+
+// hasConnPool 返回是否配置了连接池参数.
+func (o *Options) hasConnPool() bool {
+	return o.MaxIdleConns > 0 || o.MaxOpenConns > 0 ||
+		o.ConnMaxLifetimeInMills > 0 || o.ConnMaxIdleTimeInMills > 0
+}
+
+// openDB 创建数据库方言.
+//
+// 配置了连接池参数时, 初始化后按配置设置连接池. 从库通过 dbresolver 初始化,
+// 同样应用从库配置中的连接池参数.
 func (o *Options) openDB(dial Dialector) (gorm.Dialector, error) {
+	if o.hasConnPool() {
+		dial = WithInitializeHook(dial, optionsConnPoolHook(o))
+	}
 	dl, err := dial(o)
 	if err != nil {
 		return nil, err
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -328,3 +329,42 @@ func TestMultiRWOptions(t *testing.T) {
 		}
 	}
 }
+
+func TestRWOptions_OpenDB_ConnPool(t *testing.T) {
+	r := NewRegistry()
+	opts := &RWOptions{
+		Write: &Options{DBName: "rwoptions_pool_w", MaxOpenConns: 7, ConnMaxLifetimeInMills: 1000},
+		Read:  &Options{DBName: "rwoptions_pool_r", MaxOpenConns: 3, ConnMaxIdleTimeInMills: 1000},
+	}
+	if _, err := opts.OpenDB(r.Dialector(testdb_dial(t)), nil); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close(context.Background())
+
+	cases := []struct {
+		name string
+		max  int
+	}{
+		{name: opts.Write.fullName(), max: 7},
+		{name: opts.Read.fullName(), max: 3},
+	}
+	for _, c := range cases {
+		ds := r.dbs[c.name]
+		if len(ds) != 1 {
+			t.Fatalf("expect database %s registered, got: %v", c.name, r.Names())
+		}
+		if n := ds[0].Stats().MaxOpenConnections; n != c.max {
+			t.Errorf("expect %s max open connections: %d, got: %d", c.name, c.max, n)
+		}
+	}
+}
+
+func TestOptions_ConnMaxTime(t *testing.T) {
+	opts := &Options{ConnMaxLifetimeInMills: 1500, ConnMaxIdleTimeInMills: 500}
+	if d := opts.ConnMaxLifetime(); d != 1500*time.Millisecond {
+		t.Errorf("expect: %v, got: %v", 1500*time.Millisecond, d)
+	}
+	if d := opts.ConnMaxIdleTime(); d != 500*time.Millisecond {
+		t.Errorf("expect: %v, got: %v", 500*time.Millisecond, d)
+	}
+}
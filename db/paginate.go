@@ -0,0 +1,357 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Cursor 代表分页位置, 通过 PageTokenCodec 编码为不透明的 page token.
+type Cursor struct {
+	// 排序规则, 校验 token 与查询一致.
+	Sort string `json:"s"`
+	// keyset 分页: 边界记录的排序字段值.
+	Values []json.RawMessage `json:"v,omitempty"`
+	// keyset 分页: 为 true 时查询边界记录之前的一页.
+	Backward bool `json:"b,omitempty"`
+	// offset 分页: 偏移量.
+	Offset int `json:"o,omitempty"`
+}
+
+// PageTokenCodec 实现 Cursor 与 page token 的转换.
+//
+// token 格式: base64(json(Cursor)).base64(HMAC-SHA256), 防止客户端篡改.
+type PageTokenCodec struct {
+	key []byte
+}
+
+// NewPageTokenCodec 创建 PageTokenCodec, key 为 HMAC 密钥.
+func NewPageTokenCodec(key []byte) *PageTokenCodec {
+	return &PageTokenCodec{key: key}
+}
+
+// Encode 编码 Cursor, cursor 为 nil 时返回空字符串.
+func (c *PageTokenCodec) Encode(cursor *Cursor) (string, error) {
+	if cursor == nil {
+		return "", nil
+	}
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(c.sign(payload)), nil
+}
+
+// Decode 解码 page token, token 为空时返回 nil, 代表第一页.
+//
+// token 格式错误或签名不匹配时返回 ErrInvalidPageToken.
+func (c *PageTokenCodec) Decode(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidPageToken
+	}
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	sig, err := enc.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, c.sign(payload)) {
+		return nil, ErrInvalidPageToken
+	}
+	cursor := &Cursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	return cursor, nil
+}
+
+func (c *PageTokenCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Pagination 实现分页查询, 每次查询创建.
+//
+// 通过 Scope 应用到查询, 查询后通过 Cursors 截取结果并返回上一页/下一页位置.
+type Pagination struct {
+	cursor  *Cursor
+	limit   int
+	orderBy []string
+	keyset  bool
+
+	// Scope 解析的排序规则.
+	ctx    context.Context
+	parsed bool
+	sort   string
+	fields []*schema.Field
+	desc   []bool
+}
+
+// Paginate 创建 keyset 分页.
+//
+// orderBy 为字段名或列名, "-" 前缀代表降序; 未包含主键时追加主键, 保证排序唯一.
+// 按排序字段值定位边界记录, 排序方向一致时生成 WHERE (a, b) > (?, ?),
+// 否则展开为 a > ? OR (a = ? AND b < ?).
+//
+// cursor 为 nil 时查询第一页; limit 小于 1 时为 DefaultPageSize.
+//
+// 例:
+//	cursor, err := codec.Decode(req.PageToken)
+//	pg := db.Paginate(cursor, 20, "-created_at")
+//	err = p.UseDB(ctx).Scopes(pg.Scope).Find(&users).Error
+//	next, prev, err := pg.Cursors(&users)
+//	resp.NextPageToken, err = codec.Encode(next)
+func Paginate(cursor *Cursor, limit int, orderBy ...string) *Pagination {
+	return newPagination(cursor, limit, orderBy, true)
+}
+
+// PaginateOffset 创建 offset 分页, 参数同 Paginate.
+func PaginateOffset(cursor *Cursor, limit int, orderBy ...string) *Pagination {
+	return newPagination(cursor, limit, orderBy, false)
+}
+
+func newPagination(cursor *Cursor, limit int, orderBy []string, keyset bool) *Pagination {
+	if limit < 1 {
+		limit = DefaultPageSize
+	}
+	return &Pagination{cursor: cursor, limit: limit, orderBy: orderBy, keyset: keyset}
+}
+
+// Scope 添加分页条件, 排序与数量限制.
+//
+// 多查询一条记录, 用于判断是否存在下一页, 由 Cursors 截取.
+func (p *Pagination) Scope(db *gorm.DB) *gorm.DB {
+	stmt := db.Statement
+	model := stmt.Model
+	if model == nil {
+		model = stmt.Dest
+	}
+	if err := stmt.Parse(model); err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	if err := p.parse(stmt.Schema); err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	p.ctx = stmt.Context
+	if p.cursor != nil && p.cursor.Sort != p.sort {
+		_ = db.AddError(fmt.Errorf("%w: sort mismatch", ErrInvalidPageToken))
+		return db
+	}
+
+	backward := p.keyset && p.cursor != nil && p.cursor.Backward
+	var orders clause.OrderBy
+	for i, f := range p.fields {
+		orders.Columns = append(orders.Columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName},
+			Desc:   p.desc[i] != backward,
+		})
+	}
+	if len(orders.Columns) > 0 {
+		db = db.Clauses(orders)
+	}
+	db = db.Limit(p.limit + 1)
+	if p.cursor == nil {
+		return db
+	}
+	if !p.keyset {
+		if p.cursor.Offset < 0 {
+			_ = db.AddError(ErrInvalidPageToken)
+			return db
+		}
+		return db.Offset(p.cursor.Offset)
+	}
+
+	values, err := p.values(p.cursor)
+	if err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	return db.Where(p.keysetCondition(values, backward))
+}
+
+// Cursors 截取查询结果, 返回下一页和上一页位置, 不存在时为 nil.
+//
+// dest 为 Find 使用的切片指针.
+func (p *Pagination) Cursors(dest interface{}) (next *Cursor, prev *Cursor, err error) {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return nil, nil, fmt.Errorf("unsupported pagination dest: %T", dest)
+	}
+	if !p.parsed {
+		return nil, nil, errors.New("pagination scope not applied")
+	}
+	rv = rv.Elem()
+	more := rv.Len() > p.limit
+	if more {
+		rv.Set(rv.Slice(0, p.limit))
+	}
+
+	if !p.keyset {
+		offset := 0
+		if p.cursor != nil {
+			offset = p.cursor.Offset
+		}
+		if more {
+			next = &Cursor{Sort: p.sort, Offset: offset + p.limit}
+		}
+		if offset > 0 {
+			prev = &Cursor{Sort: p.sort, Offset: offset - p.limit}
+			if prev.Offset < 0 {
+				prev.Offset = 0
+			}
+		}
+		return next, prev, nil
+	}
+
+	backward := p.cursor != nil && p.cursor.Backward
+	if backward {
+		swap := reflect.Swapper(rv.Interface())
+		for i, j := 0, rv.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	if rv.Len() == 0 {
+		return nil, nil, nil
+	}
+	// 多出的记录代表查询方向上存在更多记录, 另一方向为 cursor 来源页.
+	hasNext, hasPrev := more, p.cursor != nil
+	if backward {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		if next, err = p.cursorOf(rv.Index(rv.Len()-1), false); err != nil {
+			return nil, nil, err
+		}
+	}
+	if hasPrev {
+		if prev, err = p.cursorOf(rv.Index(0), true); err != nil {
+			return nil, nil, err
+		}
+	}
+	return next, prev, nil
+}
+
+// parse 转换排序字段, 只允许模型字段, 防止注入.
+func (p *Pagination) parse(sch *schema.Schema) error {
+	p.fields, p.desc = nil, nil
+	names := make([]string, 0, len(p.orderBy)+1)
+	hasPrimary := false
+	for _, s := range p.orderBy {
+		desc := strings.HasPrefix(s, "-")
+		f := sch.LookUpField(strings.TrimPrefix(s, "-"))
+		if f == nil || f.DBName == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidSort, s)
+		}
+		if f == sch.PrioritizedPrimaryField {
+			hasPrimary = true
+		}
+		p.fields = append(p.fields, f)
+		p.desc = append(p.desc, desc)
+	}
+	if !hasPrimary {
+		if sch.PrioritizedPrimaryField != nil {
+			p.fields = append(p.fields, sch.PrioritizedPrimaryField)
+			p.desc = append(p.desc, false)
+		} else if p.keyset {
+			return fmt.Errorf("%w: primary key required by keyset pagination", ErrInvalidSort)
+		}
+	}
+	for i, f := range p.fields {
+		if p.desc[i] {
+			names = append(names, "-"+f.DBName)
+		} else {
+			names = append(names, f.DBName)
+		}
+	}
+	p.sort = strings.Join(names, ",")
+	p.parsed = true
+	return nil
+}
+
+// values 按排序字段类型解码边界值.
+func (p *Pagination) values(cursor *Cursor) ([]interface{}, error) {
+	if len(cursor.Values) != len(p.fields) {
+		return nil, ErrInvalidPageToken
+	}
+	values := make([]interface{}, 0, len(p.fields))
+	for i, f := range p.fields {
+		v := reflect.New(f.FieldType)
+		if err := json.Unmarshal(cursor.Values[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+		}
+		values = append(values, v.Elem().Interface())
+	}
+	return values, nil
+}
+
+func (p *Pagination) keysetCondition(values []interface{}, backward bool) clause.Expression {
+	columns := make([]interface{}, 0, len(p.fields))
+	for _, f := range p.fields {
+		columns = append(columns, clause.Column{Table: clause.CurrentTable, Name: f.DBName})
+	}
+	greater := func(i int) bool {
+		return p.desc[i] == backward
+	}
+
+	uniform := true
+	for i := range p.desc {
+		uniform = uniform && p.desc[i] == p.desc[0]
+	}
+	if uniform {
+		op := "<"
+		if greater(0) {
+			op = ">"
+		}
+		return clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{columns, values}}
+	}
+
+	// a > ? OR (a = ? AND b > ?) OR ...
+	var or []clause.Expression
+	for i := range p.fields {
+		and := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: columns[j], Value: values[j]})
+		}
+		if greater(i) {
+			and = append(and, clause.Gt{Column: columns[i], Value: values[i]})
+		} else {
+			and = append(and, clause.Lt{Column: columns[i], Value: values[i]})
+		}
+		or = append(or, clause.And(and...))
+	}
+	return clause.Or(or...)
+}
+
+func (p *Pagination) cursorOf(record reflect.Value, backward bool) (*Cursor, error) {
+	record = reflect.Indirect(record)
+	cursor := &Cursor{Sort: p.sort, Backward: backward}
+	for _, f := range p.fields {
+		v, _ := f.ValueOf(p.ctx, record)
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		cursor.Values = append(cursor.Values, raw)
+	}
+	return cursor, nil
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type TestPageModel struct {
+	ID        int64
+	Score     int
+	CreatedAt time.Time
+}
+
+func testdb_page_models(t *testing.T) *TransProvider {
+	p := testdb_newprovider(t, "page")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestPageModel{}); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ms []*TestPageModel
+	for i := 1; i <= 7; i++ {
+		// score: 1, 1, 2, 2, 3, 3, 4
+		ms = append(ms, &TestPageModel{ID: int64(i), Score: (i + 1) / 2, CreatedAt: base.Add(time.Duration(i) * time.Hour)})
+	}
+	if err := p.UseDB(ctx).Create(ms).Error; err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func testdb_page_ids(ms []*TestPageModel) string {
+	ids := ""
+	for _, m := range ms {
+		ids += fmt.Sprint(m.ID)
+	}
+	return ids
+}
+
+func TestPaginate(t *testing.T) {
+	p := testdb_page_models(t)
+	ctx := context.Background()
+	codec := NewPageTokenCodec([]byte("secret"))
+
+	// page 返回当前页 ID 及下一页/上一页 token.
+	page := func(t *testing.T, token string, newf func(*Cursor) *Pagination) (string, string, string) {
+		cursor, err := codec.Decode(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pg := newf(cursor)
+		var ms []*TestPageModel
+		if err := p.UseDB(ctx).Scopes(pg.Scope).Find(&ms).Error; err != nil {
+			t.Fatal(err)
+		}
+		next, prev, err := pg.Cursors(&ms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextToken, _ := codec.Encode(next)
+		prevToken, _ := codec.Encode(prev)
+		return testdb_page_ids(ms), nextToken, prevToken
+	}
+
+	t.Run("keyset", func(t *testing.T) {
+		newf := func(c *Cursor) *Pagination { return Paginate(c, 3, "-created_at") }
+		ids, next, prev := page(t, "", newf)
+		if ids != "765" || next == "" || prev != "" {
+			t.Fatalf("unexpected first page: %s, %q, %q", ids, next, prev)
+		}
+		ids, next, prev = page(t, next, newf)
+		if ids != "432" || next == "" || prev == "" {
+			t.Fatalf("unexpected second page: %s, %q, %q", ids, next, prev)
+		}
+		second := prev
+		ids, last, _ := page(t, next, newf)
+		if ids != "1" || last != "" {
+			t.Fatalf("unexpected last page: %s, %q", ids, last)
+		}
+		ids, _, prev = page(t, second, newf)
+		if ids != "765" || prev != "" {
+			t.Fatalf("unexpected previous page: %s, %q", ids, prev)
+		}
+	})
+
+	t.Run("keyset mixed order", func(t *testing.T) {
+		newf := func(c *Cursor) *Pagination { return Paginate(c, 3, "-score", "id") }
+		ids, next, _ := page(t, "", newf)
+		if ids != "756" {
+			t.Fatalf("unexpected first page: %s", ids)
+		}
+		ids, next, prev := page(t, next, newf)
+		if ids != "341" {
+			t.Fatalf("unexpected second page: %s", ids)
+		}
+		if ids, _, _ = page(t, next, newf); ids != "2" {
+			t.Fatalf("unexpected last page: %s", ids)
+		}
+		if ids, _, _ = page(t, prev, newf); ids != "756" {
+			t.Fatalf("unexpected previous page: %s", ids)
+		}
+	})
+
+	t.Run("offset", func(t *testing.T) {
+		newf := func(c *Cursor) *Pagination { return PaginateOffset(c, 3, "score") }
+		ids, next, prev := page(t, "", newf)
+		if ids != "123" || prev != "" {
+			t.Fatalf("unexpected first page: %s, %q", ids, prev)
+		}
+		ids, next, prev = page(t, next, newf)
+		if ids != "456" || prev == "" {
+			t.Fatalf("unexpected second page: %s, %q", ids, prev)
+		}
+		if ids, next, _ = page(t, next, newf); ids != "7" || next != "" {
+			t.Fatalf("unexpected last page: %s, %q", ids, next)
+		}
+		if ids, _, _ = page(t, prev, newf); ids != "123" {
+			t.Fatalf("unexpected previous page: %s", ids)
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		token, _ := codec.Encode(&Cursor{Sort: "score,id", Offset: 3})
+		if _, err := NewPageTokenCodec([]byte("other")).Decode(token); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("expect: %v, got: %v", ErrInvalidPageToken, err)
+		}
+		if _, err := codec.Decode("x" + token); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("expect: %v, got: %v", ErrInvalidPageToken, err)
+		}
+		cursor, err := codec.Decode(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ms []*TestPageModel
+		err = p.UseDB(ctx).Scopes(Paginate(cursor, 3, "-score").Scope).Find(&ms).Error
+		if !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("expect sort mismatch: %v, got: %v", ErrInvalidPageToken, err)
+		}
+		err = p.UseDB(ctx).Scopes(Paginate(nil, 3, "score desc").Scope).Find(&ms).Error
+		if !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("expect: %v, got: %v", ErrInvalidSort, err)
+		}
+	})
+}
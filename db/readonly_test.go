@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTransProvider_ReadOnly(t *testing.T) {
+	p := testdb_newprovider(t, "a", "b")
+	ctxA := testdb_new_context_with_dbname("a")
+	ctxB := testdb_new_context_with_dbname("b")
+	write := func(ctx context.Context, id int64) error {
+		return p.UseWriteDB(ctx).Create(&TestDBModel{ID: id, Name: "w"}).Error
+	}
+	read := func(ctx context.Context) error {
+		return p.UseDB(ctx).First(&TestDBModel{}, testDBNameRecordID).Error
+	}
+	trans := func(ctx context.Context) error {
+		return p.Transaction(ctx, func(ctx context.Context) error {
+			return nil
+		})
+	}
+
+	t.Run("all", func(t *testing.T) {
+		p.SetReadOnly(true)
+		if !p.IsReadOnly(ctxA) || !p.IsReadOnly(ctxB) {
+			t.Errorf("expect read-only")
+		}
+		if err := write(ctxA, 1); !errors.Is(err, ErrReadOnlyMode) {
+			t.Errorf("expect: %v, got: %v", ErrReadOnlyMode, err)
+		}
+		if err := trans(ctxB); !errors.Is(err, ErrReadOnlyMode) {
+			t.Errorf("expect: %v, got: %v", ErrReadOnlyMode, err)
+		}
+		if err := read(ctxA); err != nil {
+			t.Errorf("expect read allowed, got: %v", err)
+		}
+		p.SetReadOnly(false)
+		if err := write(ctxA, 1); err != nil {
+			t.Errorf("expect write allowed, got: %v", err)
+		}
+	})
+
+	t.Run("per database", func(t *testing.T) {
+		p.SetReadOnlyDB("a", true)
+		if err := write(ctxA, 2); !errors.Is(err, ErrReadOnlyMode) {
+			t.Errorf("expect: %v, got: %v", ErrReadOnlyMode, err)
+		}
+		if err := trans(ctxA); !errors.Is(err, ErrReadOnlyMode) {
+			t.Errorf("expect: %v, got: %v", ErrReadOnlyMode, err)
+		}
+		if err := write(ctxB, 2); err != nil {
+			t.Errorf("expect other database writable, got: %v", err)
+		}
+		if err := trans(ctxB); err != nil {
+			t.Errorf("expect other database writable, got: %v", err)
+		}
+		p.SetReadOnlyDB("a", false)
+		if err := write(ctxA, 2); err != nil {
+			t.Errorf("expect write allowed, got: %v", err)
+		}
+	})
+
+	t.Run("in flight transaction", func(t *testing.T) {
+		err := p.Transaction(ctxA, func(ctx context.Context) error {
+			p.SetReadOnly(true)
+			defer p.SetReadOnly(false)
+			// 已开启的事务不受影响.
+			if err := write(ctx, 3); err != nil {
+				return err
+			}
+			// 嵌套事务同样不受影响.
+			return p.Transaction(ctx, func(ctx context.Context) error {
+				return write(ctx, 4)
+			})
+		})
+		if err != nil {
+			t.Errorf("expect in flight transaction committed, got: %v", err)
+		}
+		if err := p.UseDB(ctxA).First(&TestDBModel{}, 4).Error; err != nil {
+			t.Errorf("expect nested transaction committed, got: %v", err)
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		p.ApplyReadOnly(&ReadOnlyOptions{Databases: []string{"b"}})
+		if p.IsReadOnly(ctxA) || !p.IsReadOnly(ctxB) {
+			t.Errorf("unexpected read-only state")
+		}
+		p.ApplyReadOnly(nil)
+		if p.IsReadOnly(ctxA) || p.IsReadOnly(ctxB) {
+			t.Errorf("expect read-only disabled")
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRegistryClosed = errors.New("database registry closed")
+)
+
+// NewRegistry 创建数据库生命周期管理器.
+//
+// 例:
+//	registry := NewRegistry()
+//	dial := registry.Dialector(mysql.Dialector)
+//	source, err := dbopts.ToSource(dial, &gorm.Config{})
+//	provider := registry.NewProvider(source, scopes...)
+//	di.OnStop(registry.Close)
+func NewRegistry() *Registry {
+	return &Registry{
+		dbs:  make(map[string][]*sql.DB),
+		idle: make(chan struct{}),
+	}
+}
+
+// Registry 管理已打开数据库的生命周期.
+//
+// 通过 Registry.Dialector 打开的数据库(包括 dbresolver 注册的从库)都会被记录,
+// Close 时统一关闭.
+//
+// 通过 Registry.NewProvider 创建的 Provider 开启的事务会被追踪, Close 时等待
+// 进行中的事务结束.
+type Registry struct {
+	mut sync.Mutex
+	// 数据库名 -> 连接池.
+	dbs map[string][]*sql.DB
+	// 进行中的事务数.
+	inflight int
+	// 无进行中事务时关闭.
+	idle    chan struct{}
+	closing bool
+}
+
+// Dialector 装饰 Dialector, 记录数据库初始化后的连接池.
+func (r *Registry) Dialector(dial Dialector) Dialector {
+	return func(opts *Options) (gorm.Dialector, error) {
+		name := opts.fullName()
+		hook := func(db *gorm.DB) error {
+			return r.Register(name, db)
+		}
+		return WithInitializeHook(dial, hook)(opts)
+	}
+}
+
+// Register 记录已打开的数据库.
+//
+// Registry 关闭后注册返回 ErrRegistryClosed.
+func (r *Registry) Register(name string, db *gorm.DB) error {
+	d, err := db.DB()
+	if err != nil {
+		return err
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.closing {
+		return ErrRegistryClosed
+	}
+	r.dbs[name] = append(r.dbs[name], d)
+	return nil
+}
+
+// Names 返回已记录的数据库名.
+func (r *Registry) Names() []string {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	names := make([]string, 0, len(r.dbs))
+	for name := range r.dbs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// NewProvider 创建事务受 Registry 追踪的 db.Provider.
+func (r *Registry) NewProvider(source Source, scopes ...func(*gorm.DB) *gorm.DB) *TransProvider {
+	p := NewProvider(source, scopes...)
+	p.registry = r
+	return p
+}
+
+// enter 标记事务开始, 返回事务结束回调.
+//
+// Registry 关闭中或已关闭时返回 ErrRegistryClosed.
+func (r *Registry) enter() (func(), error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.closing {
+		return nil, ErrRegistryClosed
+	}
+	r.inflight++
+	return r.leave, nil
+}
+
+// leave 标记事务结束.
+func (r *Registry) leave() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.inflight--
+	if r.closing && r.inflight == 0 {
+		close(r.idle)
+	}
+}
+
+// Close 关闭所有已记录的数据库.
+//
+// 关闭开始后不再接受新事务, 等待进行中的事务结束或 ctx 结束后关闭连接池.
+//
+// ctx 先结束时仍关闭连接池, 并返回 ctx.Err().
+//
+// 重复调用 Close 返回 nil.
+func (r *Registry) Close(ctx context.Context) error {
+	r.mut.Lock()
+	if r.closing {
+		r.mut.Unlock()
+		return nil
+	}
+	r.closing = true
+	if r.inflight == 0 {
+		close(r.idle)
+	}
+	r.mut.Unlock()
+
+	var waitErr error
+	select {
+	case <-r.idle:
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	var errs []string
+	for name, ds := range r.dbs {
+		for _, d := range ds {
+			if err := d.Close(); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close databases: %s", strings.Join(errs, "; "))
+	}
+	return waitErr
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testdb_newregistry_provider(t *testing.T, name string) (*Registry, *TransProvider) {
+	r := NewRegistry()
+	opts := &RWOptions{
+		Write: &Options{DBName: name + "_write"},
+		Read:  &Options{DBName: name + "_read"},
+	}
+	source, err := opts.ToSource(r.Dialector(testdb_dial(t)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, r.NewProvider(source)
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r, _ := testdb_newregistry_provider(t, "registry")
+	if n := len(r.Names()); n != 2 {
+		t.Errorf("expect write and read registered, got: %v", r.Names())
+	}
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(context.Background()); err != nil {
+		t.Errorf("expect closed twice without error, got: %v", err)
+	}
+}
+
+func TestRegistry_Close_WaitTransaction(t *testing.T) {
+	r, p := testdb_newregistry_provider(t, "registry_wait")
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	txErr := make(chan error, 1)
+	go func() {
+		txErr <- p.Transaction(ctx, func(ctx context.Context) error {
+			close(started)
+			<-release
+			if err := p.UseDB(ctx).Create(&TestDBModel{ID: 1, Name: "in flight"}).Error; err != nil {
+				return err
+			}
+			// 进行中事务的嵌套事务不受关闭影响.
+			return p.Transaction(ctx, func(ctx context.Context) error {
+				return p.UseDB(ctx).Create(&TestDBModel{ID: 2, Name: "nested"}).Error
+			})
+		})
+	}()
+	<-started
+
+	closed := make(chan error, 1)
+	go func() { closed <- r.Close(ctx) }()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("expect close wait for transaction, got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	err := p.Transaction(ctx, func(ctx context.Context) error { return nil })
+	if !errors.Is(err, ErrRegistryClosed) {
+		t.Errorf("expect: %v, got: %v", ErrRegistryClosed, err)
+	}
+
+	close(release)
+	if err := <-txErr; err != nil {
+		t.Errorf("expect transaction committed, got: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("expect closed, got: %v", err)
+	}
+}
+
+func TestRegistry_Close_Deadline(t *testing.T) {
+	r, p := testdb_newregistry_provider(t, "registry_deadline")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	go p.Transaction(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidSort = errors.New("invalid sort field")
+)
+
+// DefaultPageSize 是 PageRequest 未指定每页数量时的默认值.
+var DefaultPageSize = 20
+
+// PageRequest 代表分页与排序参数.
+type PageRequest struct {
+	// 页码, 从 1 开始, 小于 1 时为 1.
+	Page int
+	// 每页数量, 小于 1 时为 DefaultPageSize.
+	Size int
+	// 排序字段, 字段名或列名, "-" 前缀代表降序, 如: []string{"-created_at", "id"}.
+	Sort []string
+}
+
+// Page 代表分页结果.
+type Page[T any] struct {
+	Items []*T
+	// 符合条件的记录总数.
+	Total int64
+	Page  int
+	Size  int
+}
+
+// Repository 实现模型的通用增删改查.
+//
+// T 为模型结构体, ID 为主键类型, 只支持单一主键.
+//
+// 读操作使用 Provider.UseDB, 写操作使用 Provider.UseWriteDB;
+// 在事务上下文内均使用事务 DB.
+//
+// 记录不存在时返回 ErrNotFound.
+//
+// 例:
+//	type UserRepository struct {
+//		*db.Repository[User, int64]
+//	}
+//
+//	func NewUserRepository(p db.Provider) *UserRepository {
+//		return &UserRepository{Repository: db.NewRepository[User, int64](p)}
+//	}
+type Repository[T any, ID comparable] struct {
+	provider Provider
+}
+
+// NewRepository 创建模型 T 的 Repository.
+func NewRepository[T any, ID comparable](p Provider) *Repository[T, ID] {
+	return &Repository[T, ID]{provider: p}
+}
+
+// UseDB 返回模型 T 的读会话, 用于自定义查询.
+func (r *Repository[T, ID]) UseDB(ctx context.Context) *gorm.DB {
+	return r.provider.UseDB(ctx).Model(new(T))
+}
+
+// UseWriteDB 返回模型 T 的写会话, 用于自定义更新.
+func (r *Repository[T, ID]) UseWriteDB(ctx context.Context) *gorm.DB {
+	return r.provider.UseWriteDB(ctx).Model(new(T))
+}
+
+// Get 按主键查询记录.
+func (r *Repository[T, ID]) Get(ctx context.Context, id ID) (*T, error) {
+	m := new(T)
+	err := r.UseDB(ctx).Where(primaryKeyEq(id)).Take(m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, r.notFound(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FindBy 按条件查询记录, 条件同 gorm.DB.Where.
+//
+// 例:
+//	users, err := repo.FindBy(ctx, "name = ?", "alice")
+//	users, err := repo.FindBy(ctx, map[string]interface{}{"name": "alice"})
+func (r *Repository[T, ID]) FindBy(ctx context.Context, query interface{}, args ...interface{}) ([]*T, error) {
+	var ms []*T
+	err := r.UseDB(ctx).Where(query, args...).Find(&ms).Error
+	return ms, err
+}
+
+// List 分页查询记录, conds 为可选条件, 同 gorm.DB.Where.
+//
+// 未指定排序时按主键升序, 保证分页稳定.
+func (r *Repository[T, ID]) List(ctx context.Context, req PageRequest, conds ...interface{}) (*Page[T], error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Size < 1 {
+		req.Size = DefaultPageSize
+	}
+	db := r.UseDB(ctx)
+	if len(conds) > 0 {
+		db = db.Where(conds[0], conds[1:]...)
+	}
+	orders, err := r.orderBy(db, req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page[T]{Page: req.Page, Size: req.Size}
+	if err := db.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	if page.Total == 0 {
+		return page, nil
+	}
+	if len(orders.Columns) > 0 {
+		db = db.Clauses(orders)
+	}
+	err = db.Offset((req.Page - 1) * req.Size).Limit(req.Size).Find(&page.Items).Error
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Save 保存记录, 主键为空时创建, 否则更新全部字段.
+func (r *Repository[T, ID]) Save(ctx context.Context, m *T) error {
+	return r.provider.UseWriteDB(ctx).Save(m).Error
+}
+
+// Delete 按主键删除记录, 记录不存在时返回 ErrNotFound.
+func (r *Repository[T, ID]) Delete(ctx context.Context, id ID) error {
+	res := r.provider.UseWriteDB(ctx).Where(primaryKeyEq(id)).Delete(new(T))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return r.notFound(id)
+	}
+	return nil
+}
+
+// Exists 返回主键对应的记录是否存在.
+func (r *Repository[T, ID]) Exists(ctx context.Context, id ID) (bool, error) {
+	var n int64
+	err := r.UseDB(ctx).Where(primaryKeyEq(id)).Count(&n).Error
+	return n > 0, err
+}
+
+// Count 返回符合条件的记录数, conds 为可选条件, 同 gorm.DB.Where.
+func (r *Repository[T, ID]) Count(ctx context.Context, conds ...interface{}) (int64, error) {
+	db := r.UseDB(ctx)
+	if len(conds) > 0 {
+		db = db.Where(conds[0], conds[1:]...)
+	}
+	var n int64
+	err := db.Count(&n).Error
+	return n, err
+}
+
+// orderBy 转换排序字段, 只允许模型字段, 防止注入.
+func (r *Repository[T, ID]) orderBy(db *gorm.DB, sort []string) (clause.OrderBy, error) {
+	var orders clause.OrderBy
+	if err := db.Statement.Parse(db.Statement.Model); err != nil {
+		return orders, err
+	}
+	sch := db.Statement.Schema
+	for _, s := range sort {
+		desc := strings.HasPrefix(s, "-")
+		name := strings.TrimPrefix(s, "-")
+		f := sch.LookUpField(name)
+		if f == nil || f.DBName == "" {
+			return orders, fmt.Errorf("%w: %s", ErrInvalidSort, s)
+		}
+		orders.Columns = append(orders.Columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName},
+			Desc:   desc,
+		})
+	}
+	if len(orders.Columns) == 0 {
+		for _, f := range sch.PrimaryFields {
+			orders.Columns = append(orders.Columns, clause.OrderByColumn{
+				Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName},
+			})
+		}
+	}
+	return orders, nil
+}
+
+func (r *Repository[T, ID]) notFound(id ID) error {
+	return fmt.Errorf("%w: %T %v", ErrNotFound, *new(T), id)
+}
+
+func primaryKeyEq(id interface{}) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: clause.PrimaryKey}, Value: id}
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type TestRepoModel struct {
+	ID   string `gorm:"primaryKey"`
+	Name string
+	Age  int
+}
+
+func TestRepository(t *testing.T) {
+	p := testdb_newprovider(t, "repo")
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&TestRepoModel{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewRepository[TestRepoModel, string](p)
+
+	for _, m := range []*TestRepoModel{
+		{ID: "a", Name: "alice", Age: 30},
+		{ID: "b", Name: "bob", Age: 20},
+		{ID: "c", Name: "carol", Age: 40},
+	} {
+		if err := repo.Save(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		m, err := repo.Get(ctx, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Name != "bob" {
+			t.Errorf("unexpected model: %+v", m)
+		}
+		// 字符串主键不作为 SQL 条件.
+		if _, err := repo.Get(ctx, "1 = 1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expect: %v, got: %v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("find by", func(t *testing.T) {
+		ms, err := repo.FindBy(ctx, "age > ?", 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) != 2 {
+			t.Errorf("expect 2 models, got: %d", len(ms))
+		}
+		ms, err = repo.FindBy(ctx, map[string]interface{}{"name": "alice"})
+		if err != nil || len(ms) != 1 || ms[0].ID != "a" {
+			t.Errorf("unexpected models: %v, %v", ms, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		page, err := repo.List(ctx, PageRequest{Page: 1, Size: 2, Sort: []string{"-Age"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 3 || len(page.Items) != 2 || page.Items[0].ID != "c" || page.Items[1].ID != "a" {
+			t.Errorf("unexpected page: %+v", page)
+		}
+		page, err = repo.List(ctx, PageRequest{Page: 2, Size: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != "c" {
+			t.Errorf("unexpected page: %+v", page)
+		}
+		page, err = repo.List(ctx, PageRequest{Sort: []string{"age"}}, "age < ?", 35)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 2 || page.Size != DefaultPageSize || page.Items[0].ID != "b" {
+			t.Errorf("unexpected page: %+v", page)
+		}
+		if _, err := repo.List(ctx, PageRequest{Sort: []string{"age; DROP TABLE x"}}); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("expect: %v, got: %v", ErrInvalidSort, err)
+		}
+	})
+
+	t.Run("exists and count", func(t *testing.T) {
+		ok, err := repo.Exists(ctx, "a")
+		if err != nil || !ok {
+			t.Errorf("expect exists, got: %v, %v", ok, err)
+		}
+		ok, err = repo.Exists(ctx, "x")
+		if err != nil || ok {
+			t.Errorf("expect not exists, got: %v, %v", ok, err)
+		}
+		n, err := repo.Count(ctx)
+		if err != nil || n != 3 {
+			t.Errorf("expect 3, got: %d, %v", n, err)
+		}
+		n, err = repo.Count(ctx, "age >= ?", 30)
+		if err != nil || n != 2 {
+			t.Errorf("expect 2, got: %d, %v", n, err)
+		}
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		err := p.Transaction(ctx, func(ctx context.Context) error {
+			if err := repo.Save(ctx, &TestRepoModel{ID: "d", Name: "dave"}); err != nil {
+				return err
+			}
+			if ok, _ := repo.Exists(ctx, "d"); !ok {
+				t.Errorf("expect model visible in transaction")
+			}
+			return errors.New("rollback")
+		})
+		if err == nil {
+			t.Fatal("expect rollback error")
+		}
+		if ok, _ := repo.Exists(ctx, "d"); ok {
+			t.Errorf("expect model rolled back")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := repo.Delete(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Delete(ctx, "a"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expect: %v, got: %v", ErrNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/db"
+)
+
+// Dialector 定义 sqlite 数据库配置与方言转换函数, DBName 为数据库文件路径.
+//
+// 用于测试与本地开发.
+func Dialector(opts *db.Options) (gorm.Dialector, error) {
+	dial := db.WithInitializeHook(dialector, db.ErrorTranslateHook(TranslateError))
+	return dial(opts)
+}
+
+func dialector(opts *db.Options) (gorm.Dialector, error) {
+	return sqlite.Open(opts.DBName), nil
+}
+
+// TranslateError 分类 sqlite 驱动错误, 用于 db.ErrorTranslateHook.
+//
+// sqlite 不返回约束名, Constraint 为冲突的列, 如: users.email.
+func TranslateError(err error) *db.Error {
+	var se sqlite3.Error
+	if !errors.As(err, &se) {
+		return nil
+	}
+	switch se.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return &db.Error{Kind: db.ErrDuplicateKey, Constraint: constraintColumns(se.Error()), Err: err}
+	case sqlite3.ErrConstraintForeignKey:
+		return &db.Error{Kind: db.ErrForeignKeyViolation, Err: err}
+	}
+	switch se.Code {
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return &db.Error{Kind: db.ErrLockTimeout, Err: err}
+	case sqlite3.ErrCantOpen:
+		return &db.Error{Kind: db.ErrConnection, Err: err}
+	}
+	return nil
+}
+
+// constraintColumns 返回约束错误信息中的列, 如: UNIQUE constraint failed: users.email.
+func constraintColumns(msg string) string {
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		return msg[i+2:]
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/db"
+)
+
+type testParent struct {
+	ID    int64
+	Email string `gorm:"uniqueIndex"`
+}
+
+type testChild struct {
+	ID       int64
+	ParentID int64
+	Parent   *testParent
+}
+
+func TestTranslateError(t *testing.T) {
+	opts := &db.Options{DBName: filepath.Join(t.TempDir(), "errors.db") + "?_foreign_keys=on"}
+	source, err := opts.ToSource(Dialector, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := db.NewProvider(source)
+	ctx := context.Background()
+	if err := p.UseDB(ctx).AutoMigrate(&testParent{}, &testChild{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UseDB(ctx).Create(&testParent{ID: 1, Email: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var e *db.Error
+	err = p.UseDB(ctx).Create(&testParent{ID: 2, Email: "a"}).Error
+	if !errors.Is(err, db.ErrDuplicateKey) || !errors.As(err, &e) || e.Constraint != "test_parents.email" {
+		t.Errorf("expect duplicate key, got: %v, %+v", err, e)
+	}
+	err = p.UseDB(ctx).Create(&testParent{ID: 1, Email: "b"}).Error
+	if !errors.Is(err, db.ErrDuplicateKey) {
+		t.Errorf("expect duplicate primary key, got: %v", err)
+	}
+	err = p.UseDB(ctx).Create(&testChild{ID: 1, ParentID: 2}).Error
+	if !errors.Is(err, db.ErrForeignKeyViolation) {
+		t.Errorf("expect foreign key violation, got: %v", err)
+	}
+	err = p.UseDB(ctx).First(&testChild{}, 1).Error
+	if err != gorm.ErrRecordNotFound || !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expect: %v, got: %v", db.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/agztizoo/glue/pubsub"
+)
+
+var (
+	// TenantTagName 标记模型租户字段的 tag.
+	TenantTagName = "tenant"
+
+	ErrTenantRequired = errors.New("tenant required")
+	ErrTenantMismatch = errors.New("tenant mismatch")
+	ErrTenantRawSQL   = errors.New("raw sql not allowed without tenant isolation")
+)
+
+type withoutTenantKey struct{}
+
+// WithTenant 返回携带租户 ID 的 context.
+//
+// 与消息头 pubsub.MessageHeaderTenantID 使用相同的 key,
+// 可通过 TenantContextRender 渲染到消息头.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, pubsub.MessageHeaderTenantID, tenantID)
+}
+
+// TenantFromContext 返回 context 中的租户 ID.
+//
+// 可作为 NewInjectFromContextScope 与 TenantHook 的 keyFrom.
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(pubsub.MessageHeaderTenantID).(string)
+	return tenantID
+}
+
+// NewInjectTenantScope 使用 TenantFromContext 注入租户条件.
+//
+// 与 TenantHook 使用相同的租户解析, 用于未安装 TenantHook 的数据库.
+func NewInjectTenantScope(field string, optional bool) func(*gorm.DB) *gorm.DB {
+	return NewInjectFromContextScope(field, TenantFromContext, optional)
+}
+
+// TenantContextRender 从 context 提取租户 ID 渲染消息头.
+//
+// 例:
+//	render := pubsub.MakeFromContextRender(TenantContextRender)
+func TenantContextRender(ctx context.Context) (string, interface{}) {
+	tenantID := TenantFromContext(ctx)
+	if tenantID == "" {
+		return "", nil
+	}
+	return pubsub.MessageHeaderTenantID, tenantID
+}
+
+// WithoutTenant 返回跳过租户隔离的 context.
+//
+// 用于跨租户的管理任务, 如: 数据迁移, 统计.
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutTenantKey{}, true)
+}
+
+func isWithoutTenant(ctx context.Context) bool {
+	without, _ := ctx.Value(withoutTenantKey{}).(bool)
+	return without
+}
+
+// TenantOption 代表 TenantHook 选项.
+type TenantOption func(*tenantIsolation)
+
+// WithRawSQLRejected 开启严格模式, 拒绝租户 context 中无法注入租户条件的语句.
+//
+// 包括 Raw, Exec 原生 SQL 和只指定 Table 未指定模型的语句, 如: Table("orders").Count(&n).
+// 无法判断这些语句的目标表是否为租户模型, 开启后非租户表同样被拒绝, 需使用 WithoutTenant(ctx).
+//
+// 默认不拒绝, 原生 SQL 由调用方自行保证租户隔离.
+func WithRawSQLRejected() TenantOption {
+	return func(t *tenantIsolation) {
+		t.strict = true
+	}
+}
+
+// TenantHook 实现多租户隔离插件.
+//
+// 模型中标记 tenant tag 的字段为租户字段, 如:
+//	type Order struct {
+//		ID       int64
+//		TenantID string `tenant:"true"`
+//	}
+//
+// 对租户模型:
+//   1. 创建: 使用 context 中的租户填充租户字段, 已有不同租户报错 ErrTenantMismatch.
+//   2. 更新: 租户字段为空时填充, 修改为其他租户报错 ErrTenantMismatch.
+//   3. 查询/更新/删除: 添加租户条件.
+//   4. context 中无租户报错 ErrTenantRequired.
+// 使用 WithoutTenant(ctx) 跳过租户隔离.
+// 原生 SQL 不做处理, 可使用 WithRawSQLRejected 拒绝.
+//
+// keyFrom 从 context 获取租户, 与 NewInjectFromContextScope 的 keyFrom 相同,
+// 已有的租户 Scope 改用插件时传入同一函数, 租户解析保持一致. 为 nil 时使用 TenantFromContext.
+// 插件在回调中注入租户条件, 不经过 Scopes 的语句和 Create 同样生效.
+//
+// 例:
+//	dial := WithInitializeHook(xxx.Dialector, TenantHook(nil))
+//	provider.UseDB(WithTenant(ctx, "tenant_a")).Find(&orders)
+func TenantHook(keyFrom func(context.Context) string, opts ...TenantOption) func(*gorm.DB) error {
+	if keyFrom == nil {
+		keyFrom = TenantFromContext
+	}
+	t := &tenantIsolation{tenantFrom: keyFrom}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return func(db *gorm.DB) error {
+		cb := db.Callback()
+		if err := cb.Create().Before("gorm:create").Register("glue:tenant", t.create); err != nil {
+			return err
+		}
+		if err := cb.Query().Before("gorm:query").Register("glue:tenant", t.query); err != nil {
+			return err
+		}
+		if err := cb.Update().Before("gorm:update").Register("glue:tenant", t.update); err != nil {
+			return err
+		}
+		if err := cb.Delete().Before("gorm:delete").Register("glue:tenant", t.where); err != nil {
+			return err
+		}
+		if err := cb.Row().Before("gorm:row").Register("glue:tenant", t.query); err != nil {
+			return err
+		}
+		return cb.Raw().Before("gorm:raw").Register("glue:tenant", t.raw)
+	}
+}
+
+type tenantIsolation struct {
+	tenantFrom func(context.Context) string
+	strict     bool
+}
+
+// tenant 返回租户字段与租户 ID, 非租户模型或跳过租户隔离返回 nil.
+func (t *tenantIsolation) tenant(db *gorm.DB) (*schema.Field, string) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, ""
+	}
+	field := tenantField(db.Statement.Schema)
+	if field == nil || isWithoutTenant(db.Statement.Context) {
+		return nil, ""
+	}
+	tenantID := t.tenantFrom(db.Statement.Context)
+	if tenantID == "" {
+		db.AddError(fmt.Errorf("%w: %s", ErrTenantRequired, db.Statement.Schema.Name))
+		return nil, ""
+	}
+	return field, tenantID
+}
+
+func (t *tenantIsolation) create(db *gorm.DB) {
+	field, tenantID := t.tenant(db)
+	if field == nil {
+		return
+	}
+	if err := fillTenant(db, field, tenantID, true); err != nil {
+		db.AddError(err)
+	}
+}
+
+func (t *tenantIsolation) update(db *gorm.DB) {
+	field, tenantID := t.tenant(db)
+	if field == nil {
+		return
+	}
+	if err := fillTenant(db, field, tenantID, false); err != nil {
+		db.AddError(err)
+		return
+	}
+	addTenantClause(db, field, tenantID)
+}
+
+func (t *tenantIsolation) where(db *gorm.DB) {
+	field, tenantID := t.tenant(db)
+	if field == nil {
+		return
+	}
+	addTenantClause(db, field, tenantID)
+}
+
+// query 处理查询, 拒绝无法注入租户条件的语句.
+func (t *tenantIsolation) query(db *gorm.DB) {
+	if t.rejectRaw(db) {
+		return
+	}
+	t.where(db)
+}
+
+func (t *tenantIsolation) raw(db *gorm.DB) {
+	t.rejectRaw(db)
+}
+
+// rejectRaw 严格模式下拒绝租户 context 中无法注入租户条件的语句.
+//
+// 语句 SQL 已构建(Raw, Exec) 或未指定模型只指定 Table 时, 添加 ErrTenantRawSQL 并返回 true.
+func (t *tenantIsolation) rejectRaw(db *gorm.DB) bool {
+	stmt := db.Statement
+	if db.Error != nil || !t.strict || isWithoutTenant(stmt.Context) || t.tenantFrom(stmt.Context) == "" {
+		return false
+	}
+	if stmt.SQL.Len() > 0 {
+		db.AddError(ErrTenantRawSQL)
+		return true
+	}
+	if stmt.Schema == nil && stmt.Table != "" {
+		db.AddError(fmt.Errorf("%w: table %s", ErrTenantRawSQL, stmt.Table))
+		return true
+	}
+	return false
+}
+
+// fillTenant 填充记录的租户字段.
+//
+// 记录已有其他租户报错. add 为 true 时, map 记录缺少租户字段也进行填充.
+func fillTenant(db *gorm.DB, field *schema.Field, tenantID string, add bool) error {
+	return walkRecords(db, func(r record) error {
+		value, isZero, ok := r.get(field)
+		if !ok && !add {
+			return nil
+		}
+		if ok && !isZero {
+			if fmt.Sprint(value) != tenantID {
+				return fmt.Errorf("%w: %v, expect: %s", ErrTenantMismatch, value, tenantID)
+			}
+			return nil
+		}
+		return r.set(field, tenantID)
+	})
+}
+
+func addTenantClause(db *gorm.DB, field *schema.Field, tenantID string) {
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID},
+	}})
+}
+
+// tenantField 返回模型租户字段, 非租户模型返回 nil.
+func tenantField(sch *schema.Schema) *schema.Field {
+	for _, field := range sch.Fields {
+		if _, ok := field.Tag.Lookup(TenantTagName); ok {
+			return field
+		}
+	}
+	return nil
+}
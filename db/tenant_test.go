@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/agztizoo/glue/pubsub"
+)
+
+type TestTenantModel struct {
+	ID       int64
+	TenantID string `tenant:"true"`
+	Name     string
+}
+
+func testdb_newprovider_tenant(t *testing.T, name string, opts ...TenantOption) *TransProvider {
+	p := testdb_newprovider_with_dial(t, WithInitializeHook(testdb_dial(t), TenantHook(nil, opts...)), name)
+	ctx := WithoutTenant(context.Background())
+	if err := p.UseDB(ctx).AutoMigrate(&TestTenantModel{}, &TestDBModel{}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestTenantHook(t *testing.T) {
+	p := testdb_newprovider_tenant(t, "tenant")
+	actx := WithTenant(context.Background(), "a")
+	bctx := WithTenant(context.Background(), "b")
+
+	t.Run("create", func(t *testing.T) {
+		m := &TestTenantModel{ID: 1, Name: "a1"}
+		if err := p.UseDB(actx).Create(m).Error; err != nil {
+			t.Fatal(err)
+		}
+		if m.TenantID != "a" {
+			t.Errorf("expect tenant filled, got: %s", m.TenantID)
+		}
+		ms := []*TestTenantModel{{ID: 2, Name: "b2"}, {ID: 3, Name: "b3", TenantID: "b"}}
+		if err := p.UseDB(bctx).Create(ms).Error; err != nil {
+			t.Fatal(err)
+		}
+		values := map[string]interface{}{"id": 4, "name": "a4"}
+		if err := p.UseDB(actx).Model(&TestTenantModel{}).Create(values).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		err := p.UseDB(actx).Create(&TestTenantModel{ID: 5, TenantID: "b"}).Error
+		if !errors.Is(err, ErrTenantMismatch) {
+			t.Errorf("expect: %v, got: %v", ErrTenantMismatch, err)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		var ms []TestTenantModel
+		if err := p.UseDB(actx).Order("id").Find(&ms).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) != 2 || ms[0].ID != 1 || ms[1].ID != 4 || ms[1].TenantID != "a" {
+			t.Errorf("unexpected models: %+v", ms)
+		}
+		var n int64
+		p.UseDB(bctx).Model(&TestTenantModel{}).Count(&n)
+		if n != 2 {
+			t.Errorf("expect 2 models of tenant b, got: %d", n)
+		}
+		if err := p.UseDB(bctx).First(&TestTenantModel{}, 1).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expect: %v, got: %v", gorm.ErrRecordNotFound, err)
+		}
+		var names []string
+		p.UseDB(actx).Model(&TestTenantModel{}).Order("id").Pluck("name", &names)
+		if len(names) != 2 {
+			t.Errorf("unexpected names: %v", names)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		res := p.UseDB(bctx).Model(&TestTenantModel{}).Where("id IN ?", []int64{1, 2}).Update("name", "updated")
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		if res.RowsAffected != 1 {
+			t.Errorf("expect 1 row of tenant b updated, got: %d", res.RowsAffected)
+		}
+		m := &TestTenantModel{ID: 1, Name: "saved"}
+		if err := p.UseDB(actx).Save(m).Error; err != nil {
+			t.Fatal(err)
+		}
+		if m.TenantID != "a" {
+			t.Errorf("expect tenant filled on save, got: %s", m.TenantID)
+		}
+		err := p.UseDB(actx).Model(m).Updates(map[string]interface{}{"tenant_id": "b"}).Error
+		if !errors.Is(err, ErrTenantMismatch) {
+			t.Errorf("expect: %v, got: %v", ErrTenantMismatch, err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		res := p.UseDB(bctx).Delete(&TestTenantModel{}, 4)
+		if res.Error != nil || res.RowsAffected != 0 {
+			t.Errorf("expect no row of tenant a deleted, got: %d, %v", res.RowsAffected, res.Error)
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		ctx := context.Background()
+		if err := p.UseDB(ctx).Find(&[]TestTenantModel{}).Error; !errors.Is(err, ErrTenantRequired) {
+			t.Errorf("expect: %v, got: %v", ErrTenantRequired, err)
+		}
+		if err := p.UseDB(ctx).Create(&TestTenantModel{ID: 9}).Error; !errors.Is(err, ErrTenantRequired) {
+			t.Errorf("expect: %v, got: %v", ErrTenantRequired, err)
+		}
+		// 非租户模型不受影响.
+		if err := p.UseDB(ctx).Find(&[]TestDBModel{}).Error; err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("without tenant", func(t *testing.T) {
+		var n int64
+		p.UseDB(WithoutTenant(context.Background())).Model(&TestTenantModel{}).Count(&n)
+		if n != 4 {
+			t.Errorf("expect all models, got: %d", n)
+		}
+	})
+}
+
+func TestTenantHook_RawSQLRejected(t *testing.T) {
+	p := testdb_newprovider_tenant(t, "tenant_raw", WithRawSQLRejected())
+	ctx := WithTenant(context.Background(), "a")
+	if err := p.UseDB(ctx).Create(&TestTenantModel{ID: 1, Name: "a1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UseDB(WithTenant(ctx, "b")).Create(&TestTenantModel{ID: 2, Name: "b2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.UseDB(ctx).Exec("DELETE FROM test_tenant_models").Error; !errors.Is(err, ErrTenantRawSQL) {
+		t.Errorf("expect: %v, got: %v", ErrTenantRawSQL, err)
+	}
+	var ms []TestTenantModel
+	if err := p.UseDB(ctx).Raw("SELECT * FROM test_tenant_models").Scan(&ms).Error; !errors.Is(err, ErrTenantRawSQL) {
+		t.Errorf("expect: %v, got: %v", ErrTenantRawSQL, err)
+	}
+	if len(ms) != 0 {
+		t.Errorf("expect raw select not executed, got: %+v", ms)
+	}
+	var n int64
+	if _, err := p.UseDB(ctx).Raw("SELECT * FROM test_tenant_models").Rows(); !errors.Is(err, ErrTenantRawSQL) {
+		t.Errorf("expect: %v, got: %v", ErrTenantRawSQL, err)
+	}
+	if err := p.UseDB(ctx).Table("test_tenant_models").Count(&n).Error; !errors.Is(err, ErrTenantRawSQL) {
+		t.Errorf("expect: %v, got: %v", ErrTenantRawSQL, err)
+	}
+	// 非租户 context 与模型语句不受影响.
+	if err := p.UseDB(context.Background()).Raw("SELECT * FROM test_tenant_models").Scan(&ms).Error; err != nil || len(ms) != 2 {
+		t.Errorf("expect raw select without tenant, got: %d, %v", len(ms), err)
+	}
+	if err := p.UseDB(ctx).Model(&TestTenantModel{}).Count(&n).Error; err != nil || n != 1 {
+		t.Errorf("expect 1 model of tenant a, got: %d, %v", n, err)
+	}
+
+	if err := p.UseDB(WithoutTenant(ctx)).Exec("DELETE FROM test_tenant_models WHERE id = ?", 2).Error; err != nil {
+		t.Error(err)
+	}
+
+	// 默认不拒绝原生 SQL 与非租户表.
+	allowed := testdb_newprovider_tenant(t, "tenant_raw_allowed")
+	if err := allowed.UseDB(ctx).Raw("SELECT * FROM test_db_models").Scan(&[]TestDBModel{}).Error; err != nil {
+		t.Error(err)
+	}
+	if err := allowed.UseDB(ctx).Table("test_db_models").Count(&n).Error; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewInjectTenantScope(t *testing.T) {
+	p := testdb_newprovider_with_scopes(t, []string{"tenant_scope"}, NewInjectTenantScope("tenant", true))
+	ctx := WithTenant(context.Background(), "tenant_scope")
+	var ms []TestDBModel
+	if err := p.UseDB(ctx).Find(&ms).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Tenant != "tenant_scope" {
+		t.Errorf("expect model of tenant_scope, got: %+v", ms)
+	}
+}
+
+func TestTenantContextRender(t *testing.T) {
+	render := pubsub.MakeFromContextRender(TenantContextRender)
+	msg := render(WithTenant(context.Background(), "a"), pubsub.NewMessage("1", nil, time.Now()))
+	if msg.GetTenantID() != "a" {
+		t.Errorf("expect tenant: a, got: %s", msg.GetTenantID())
+	}
+	msg = render(context.Background(), pubsub.NewMessage("2", nil, time.Now()))
+	if msg.GetTenantID() != "" {
+		t.Errorf("expect empty tenant, got: %s", msg.GetTenantID())
+	}
+}
@@ -0,0 +1,71 @@
+package di
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// stopHooks 全局停止回调.
+var (
+	stopMut   sync.Mutex
+	stopHooks []func(context.Context) error
+)
+
+// OnStop 注册应用停止回调.
+//
+// 回调按注册的逆序执行, 后注册的资源先释放.
+//
+// 例:
+//	MustCall(func(r *db.Registry) {
+//		OnStop(r.Close)
+//	})
+func OnStop(hook func(context.Context) error) {
+	stopMut.Lock()
+	defer stopMut.Unlock()
+	stopHooks = append(stopHooks, hook)
+}
+
+// Stop 执行应用停止回调.
+//
+// 回调出错不影响后续回调执行, 返回合并后的错误.
+// 回调执行后被清除, 重复调用不会再次执行.
+func Stop(ctx context.Context) error {
+	stopMut.Lock()
+	hooks := stopHooks
+	stopHooks = nil
+	stopMut.Unlock()
+
+	var errs []string
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to stop: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// StopOnSignal 阻塞直到收到退出信号, 然后在 timeout 内执行应用停止回调.
+//
+// 未指定 signals 时监听 SIGINT, SIGTERM.
+func StopOnSignal(timeout time.Duration, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+	<-ch
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return Stop(ctx)
+}
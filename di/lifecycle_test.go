@@ -0,0 +1,82 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStop(t *testing.T) {
+	var order []int
+	OnStop(func(context.Context) error {
+		order = append(order, 1)
+		return errors.New("first failed")
+	})
+	OnStop(func(context.Context) error {
+		order = append(order, 2)
+		return nil
+	})
+	OnStop(func(context.Context) error {
+		order = append(order, 3)
+		return errors.New("third failed")
+	})
+
+	err := Stop(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "first failed") || !strings.Contains(err.Error(), "third failed") {
+		t.Errorf("expect joined hook errors, got: %v", err)
+	}
+	if len(order) != 3 || order[0] != 3 || order[1] != 2 || order[2] != 1 {
+		t.Errorf("expect hooks run in reverse order, got: %v", order)
+	}
+
+	// 回调执行后被清除.
+	if err := Stop(context.Background()); err != nil {
+		t.Errorf("expect no hooks, got: %v", err)
+	}
+	if len(order) != 3 {
+		t.Errorf("expect hooks run once, got: %v", order)
+	}
+}
+
+func TestStopOnSignal(t *testing.T) {
+	// 先监听信号, 避免 StopOnSignal 注册前收到信号时进程退出.
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGUSR1)
+	defer signal.Stop(guard)
+
+	var deadline bool
+	OnStop(func(ctx context.Context) error {
+		_, deadline = ctx.Deadline()
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- StopOnSignal(time.Second, syscall.SIGUSR1) }()
+
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("expect stopped, got: %v", err)
+			}
+			if !deadline {
+				t.Errorf("expect stop context with timeout")
+			}
+			return
+		case <-tick.C:
+			if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatalf("expect stopped on signal")
+		}
+	}
+}
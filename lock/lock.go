@@ -0,0 +1,46 @@
+// Package lock 定义分布式锁.
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotObtained 锁被其他持有者占用.
+	ErrNotObtained = errors.New("lock not obtained")
+	// ErrNotHeld 锁已过期或被其他持有者获取.
+	ErrNotHeld = errors.New("lock not held")
+)
+
+// Locker 定义分布式锁获取接口.
+//
+// 具体实现由资源提供方提供, 如: db.Locker.
+type Locker interface {
+	// Obtain 获取 key 对应的锁, ttl 后自动过期.
+	//
+	// 锁被占用时返回 ErrNotObtained; 实现可支持重试, 直到 ctx 结束.
+	Obtain(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Lock 代表已获取的锁.
+type Lock interface {
+	// Key 返回锁的 key.
+	Key() string
+
+	// Token 返回 fencing token.
+	//
+	// 同一 key 每次获取单调递增, 用于下游拒绝过期持有者的写入.
+	Token() int64
+
+	// Refresh 续期, 锁从当前时间起 ttl 后过期.
+	//
+	// 锁已失效时返回 ErrNotHeld.
+	Refresh(ctx context.Context, ttl time.Duration) error
+
+	// Release 释放锁.
+	//
+	// 锁已失效时返回 ErrNotHeld.
+	Release(ctx context.Context) error
+}